@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// compareProviders creates the providers listed for --compare, such as gemini,local,remote:groq.
+// Each of them runs with its configured settings, the flags for a single provider do not apply.
+func compareProviders(list string, withRetry func(llms.Provider) llms.Provider) ([]llms.Candidate, error) {
+	var names []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		mode, _, _ := strings.Cut(entry, ":")
+		if !isRunMode(mode) {
+			return nil, errors.New("Invalid provider '" + entry + "' to compare. Please use one of: " + strings.Join(runModes, ", ") + ", optionally followed by :<profile> for remote.")
+		}
+		if slices.Contains(names, entry) {
+			return nil, errors.New("The provider " + entry + " is listed more than once to compare.")
+		}
+		names = append(names, entry)
+	}
+	if len(names) < 2 {
+		return nil, errors.New("Please list at least two providers to compare, such as --compare gemini,local.")
+	}
+
+	candidates := make([]llms.Candidate, 0, len(names))
+	for _, name := range names {
+		mode, profile, _ := strings.Cut(name, ":")
+		provider, _, err := newProvider(mode, providerFlags{profile: profile}, true)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, llms.Candidate{Name: name, Provider: withRetry(provider)})
+	}
+	return candidates, nil
+}
+
+// runCompare streams the response of every provider at once into its own column of the TUI and runs the commands
+// the user picked from all of them. The conversation is not saved since there is no single response to continue.
+func runCompare(candidates []llms.Candidate, req llms.Request, local bool) {
+	names := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		names[i] = candidate.Name
+	}
+
+	// Run the Bubble Tea program
+	cmds := new([]string)
+	ctx, cancel, wg := startTUI(tea.InitialCompareModel(cmds, names, local))
+	defer cancel()
+
+	// Properly close the program if something goes wrong
+	defer p.Quit()
+
+	// A failing provider only fails its own column, the others keep streaming
+	errs := make([]error, len(candidates))
+	streams := &sync.WaitGroup{}
+	for i, candidate := range candidates {
+		streams.Add(1)
+		go func() {
+			defer streams.Done()
+			errs[i] = streamPane(ctx, i, candidate.Provider, req)
+			if errs[i] != nil {
+				p.Send(tea.PaneErrorMsg{Pane: i, Err: errs[i]})
+			}
+		}()
+	}
+	streams.Wait()
+
+	p.Send(tea.GenerationDoneMsg{})
+
+	wg.Wait()
+
+	// Only fail if none of the providers answered
+	if !slices.Contains(errs, nil) {
+		os.Exit(1)
+	}
+
+	// Run the commands
+	commands.RunCommands(*cmds)
+}
+
+// streamPane streams the response of a provider into a column of the TUI, quitting the TUI early is not an error
+func streamPane(ctx context.Context, pane int, provider llms.Provider, req llms.Request) error {
+	chunks, err := provider.Stream(ctx, req)
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("Error generating content: %w", err)
+	} else if err != nil {
+		return nil
+	}
+
+	for chunk := range chunks {
+		if chunk.Err != nil && ctx.Err() != nil {
+			return nil // The user quit, the error is just the stream being torn down
+		}
+		if chunk.Err != nil {
+			return fmt.Errorf("An error occurred: %w", chunk.Err)
+		}
+		if len(chunk.Commands) > 0 {
+			p.Send(tea.PaneCommandsMsg{Pane: pane, Commands: chunk.Commands})
+			continue
+		}
+		p.Send(tea.PaneResponseMsg{Pane: pane, Text: chunk.Text})
+	}
+	return nil
+}
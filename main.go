@@ -1,8 +1,8 @@
 package main
 
 import (
-	"bufio"
-	"errors"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -10,16 +10,21 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/micr0-dev/lexido/pkg/cache"
 	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/conversation"
 	"github.com/micr0-dev/lexido/pkg/io"
-	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
-	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms"
+	_ "github.com/micr0-dev/lexido/pkg/llms/anthropic"
+	_ "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	_ "github.com/micr0-dev/lexido/pkg/llms/llamacpp"
+	_ "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	_ "github.com/micr0-dev/lexido/pkg/llms/openai"
 	"github.com/micr0-dev/lexido/pkg/llms/remote"
 	"github.com/micr0-dev/lexido/pkg/prompt"
 	"github.com/micr0-dev/lexido/pkg/tea"
-	"google.golang.org/api/googleapi"
-	"google.golang.org/api/iterator"
 
 	tearaw "github.com/charmbracelet/bubbletea"
 )
@@ -38,12 +43,31 @@ func main() {
 	gPtr := flag.Bool("g", false, "Utilize Gemini LLM")
 
 	lPtr := flag.Bool("l", false, "Utilize a local LLM via ollama")
-	mPtr := flag.String("m", "", "Specify the model to use with ollama, only required if -l is used")
+	mPtr := flag.String("m", "", "Specify the model to use with gemini, ollama, the remote API, the OpenAI compatible API or Anthropic")
 
 	rPtr := flag.Bool("r", false, "Utilize a remote REST Api LLM as per the configuration file")
+	pPtr := flag.String("p", "", "Specify the remote profile to use, implies -r")
 
+	oPtr := flag.Bool("o", false, "Utilize an OpenAI compatible chat completions API")
+	aPtr := flag.Bool("a", false, "Utilize the Anthropic Messages API")
+
+	replayPtr := flag.String("replay", "", "Replay the response recorded in the given fixture file instead of asking a model")
+	recordPtr := flag.String("record", "", "Record the streamed response to the given fixture file")
+	comparePtr := flag.String("compare", "", "Ask several providers at once and show their responses side by side, such as 'gemini,local'")
+
+	temperaturePtr := flag.String("temperature", "", "Specify the sampling temperature to use with gemini")
+	topPPtr := flag.String("topP", "", "Specify the top-p value to use with gemini")
+	topKPtr := flag.String("topK", "", "Specify the top-k value to use with gemini")
+	maxTokensPtr := flag.String("maxTokens", "", "Specify the maximum number of output tokens to use with gemini")
+	safetyPtr := flag.String("safety", "", "Specify the safety thresholds to use with gemini (none/high/medium/low, optionally per category such as dangerous=high)")
+
+	structuredPtr := flag.Bool("structured", false, "Ask providers that support tool calling to return commands as structured data")
+	noCachePtr := flag.Bool("no-cache", false, "Ask the provider even if the response is cached")
+	retriesPtr := flag.Int("retries", -1, "Specify how many times to retry rate limited or failed requests")
+
+	setFPtr := flag.String("setFallback", "", "Set the providers to fall back to in order, such as 'local,remote:groq' (none to disable)")
 	setMPtr := flag.String("setModel", "", "Set the default model to use with ollama")
-	setDPtr := flag.String("setDefault", "", "Set the default mode for lexido (gemini/local/remote)")
+	setDPtr := flag.String("setDefault", "", "Set the default mode for lexido (gemini/local/remote/openai/anthropic)")
 
 	flag.Parse()
 
@@ -58,8 +82,8 @@ func main() {
 	}
 
 	if *setDPtr != "" {
-		if *setDPtr != "gemini" && *setDPtr != "local" && *setDPtr != "remote" {
-			fmt.Println("Invalid default mode. Please use 'gemini', 'local', or 'remote'.")
+		if !isRunMode(*setDPtr) {
+			fmt.Println("Invalid default mode. Please use one of: " + strings.Join(runModes, ", ") + ".")
 			os.Exit(1)
 		} else {
 			err := io.SaveToKeyring("MODE_DEFAULT", *setDPtr)
@@ -72,6 +96,27 @@ func main() {
 		}
 	}
 
+	if *setFPtr != "" {
+		chain := *setFPtr
+		if chain == "none" {
+			chain = ""
+		}
+		for _, entry := range strings.Split(chain, ",") {
+			mode, _, _ := strings.Cut(strings.TrimSpace(entry), ":")
+			if chain != "" && !isRunMode(mode) {
+				fmt.Println("Invalid fallback provider '" + entry + "'. Please use one of: " + strings.Join(runModes, ", ") + ", optionally followed by :<profile> for remote.")
+				os.Exit(1)
+			}
+		}
+		err := io.SaveToKeyring("FALLBACK", chain)
+		if err != nil {
+			log.Printf("Error saving fallback providers: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Fallback providers set to %s.\n", *setFPtr)
+		os.Exit(0)
+	}
+
 	runMode, err := io.ReadFromKeyring("MODE_DEFAULT")
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
@@ -120,10 +165,16 @@ func main() {
 		}
 	}
 
-	if *lPtr {
+	if *replayPtr != "" {
+		runMode = "replay"
+	} else if *lPtr {
 		runMode = "local"
-	} else if *rPtr {
+	} else if *rPtr || *pPtr != "" {
 		runMode = "remote"
+	} else if *oPtr {
+		runMode = "openai"
+	} else if *aPtr {
+		runMode = "anthropic"
 	} else if *gPtr {
 		runMode = "gemini"
 	}
@@ -155,68 +206,43 @@ func main() {
 		}
 	}
 
-	if runMode == "gemini" {
-
-		// Access your API key from keyring or environment variable (backwards compatible with previous versions)
-		apiKey := os.Getenv("GOOGLE_AI_KEY")
-
-		if apiKey == "" {
-			apiKey, _ = io.ReadFromKeyring("GOOGLE_AI_KEY")
-		}
-
-		// If no API key is found, prompt the user to enter it
-		if apiKey == "" {
-			fmt.Println("No API key found.")
-			fmt.Println("Please visit https://aistudio.google.com/app/apikey to obtain your API key.")
-			fmt.Print("Enter your API key here: ")
-
-			scanner := bufio.NewScanner(os.Stdin)
-			if scanner.Scan() {
-				apiKey = scanner.Text()
-
-				// Check if the API key is valid
-				isValid, err := gemini.IsKeyValid(apiKey)
-				if !isValid {
-					fmt.Println("Invalid API key. Please try again.")
-					os.Exit(1)
-				} else if err != nil {
-					log.Printf("Error validating API key: %v\n", err)
-					os.Exit(1)
-				}
-
-				os.Setenv("GOOGLE_AI_KEY", apiKey)
-				if err := io.SaveToKeyring("GOOGLE_AI_KEY", apiKey); err != nil {
-					fmt.Println("Failed to automatically append the API key to keyring. Please add the following line to your .bashrc, .zshrc, or equivalent file manually (replace the {API_KEY_HERE} with your API key):")
-					fmt.Println("export GOOGLE_AI_KEY={API_KEY_HERE}")
-				} else {
-					fmt.Print("API key set successfully for future sessions. \n\n")
-				}
-			} else if scanner.Err() != nil {
-				log.Printf("Error reading API key: %v\n", scanner.Err())
-				os.Exit(1)
-			}
-		}
+	flags := providerFlags{
+		model:       *mPtr,
+		profile:     *pPtr,
+		temperature: *temperaturePtr,
+		topP:        *topPPtr,
+		topK:        *topKPtr,
+		maxTokens:   *maxTokensPtr,
+		safety:      *safetyPtr,
+		fixture:     *replayPtr,
+	}
 
-		err = gemini.Setup(apiKey)
-		if err != nil {
-			log.Printf("Error setting up gemini: %v\n", err)
+	// lexido models lists the models the current provider offers instead of answering a prompt
+	if flag.NArg() == 1 && flag.Arg(0) == "models" {
+		if err := listModels(runMode, flags); err != nil {
+			log.Println(err)
 			os.Exit(1)
 		}
-	} else if runMode == "local" {
-		model := *mPtr
-		if *mPtr == "" {
-			model, err = io.ReadFromKeyring("OLLAMA_MODEL")
-			if err != nil {
-				log.Printf("Error reading model: %v\n", err)
-				os.Exit(1)
-			}
-		}
+		os.Exit(0)
+	}
 
-		err := ollama.Init(model)
-		if err != nil {
-			log.Printf("Error initializing ollama: %v\n", err)
+	retryPolicy := llms.DefaultRetryPolicy
+	if *retriesPtr >= 0 {
+		retryPolicy.Attempts = *retriesPtr + 1
+	} else if retries := readSetting("RETRIES"); retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			log.Printf("Invalid RETRIES setting %q, it has to be a number of at least 0\n", retries)
 			os.Exit(1)
 		}
+		retryPolicy.Attempts = n + 1
+	}
+
+	// Show the retries in the TUI status line while waiting
+	withRetry := func(provider llms.Provider) llms.Provider {
+		return llms.WithRetry(provider, retryPolicy, func(event llms.RetryEvent) {
+			p.Send(tea.RetryMsg{Attempt: event.Attempt, Attempts: event.Attempts, Wait: event.Wait, Err: event.Err})
+		})
 	}
 
 	// Read piped input if present
@@ -226,18 +252,17 @@ func main() {
 		pipedInput = ""
 	}
 
-	var text_prompt string
+	var history []llms.Message
 
 	if *cPtr {
 		// Read previous conversation from cache if -c is present
-		cachedConversation, err := io.ReadConversationCache()
+		history, err = conversation.Load()
 		if err != nil {
 			log.Printf("Warning: Could not read cache. Starting a new conversation. Error: %v\n", err)
 		}
-		text_prompt = cachedConversation + "\n"
 	}
 
-	text_prompt += strings.Join(flag.Args(), " ")
+	text_prompt := strings.Join(flag.Args(), " ")
 
 	if text_prompt == "" {
 		text_prompt = "The user did not provide a prompt."
@@ -300,107 +325,350 @@ func main() {
 	// Detect all installed package managers
 	installedManagers := io.DetectPackageManagers()
 	pre_prompt += " The user has the following package managers installed: " + strings.Join(installedManagers, ", ") + "."
-	str_prompt := pre_prompt + "\n User: " + text_prompt
 
-	// Run the Bubble Tea program
+	req := llms.Request{
+		System:      pre_prompt,
+		History:     history,
+		Prompt:      text_prompt,
+		CommandTool: *structuredPtr || readSetting("STRUCTURED_COMMANDS") == "true",
+	}
 
-	wg := &sync.WaitGroup{}
+	if *comparePtr != "" {
+		if *replayPtr != "" || *recordPtr != "" {
+			log.Println("--compare can not be combined with --replay or --record")
+			os.Exit(1)
+		}
+		compared, err := compareProviders(*comparePtr, withRetry)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		runCompare(compared, req, strings.Contains(*comparePtr, "local"))
+		return
+	}
 
-	cmds := new([]string)
+	// The response cache is opt-in, replays and recordings always ask the provider
+	label := providerLabel(runMode, flags.profile)
+	useCache := readSetting("CACHE") == "true" && runMode != "replay" && *recordPtr == ""
+	var cacheKey string
+	var cachedEntry cache.Entry
+	var cached bool
+	if useCache {
+		// The key is built from the settings alone, so a cached answer needs neither the network nor any questions.
+		// Without the settings, such as a Gemini key that still has to be asked for, nothing is cached.
+		var cacheOpts llms.Options
+		cacheOpts, err = providerOptions(runMode, flags, false)
+		var endpoint string
+		if err == nil && runMode == "remote" {
+			endpoint, err = remoteEndpoint(flags.profile)
+		}
+		useCache = err == nil
+		cacheKey = responseCacheKey(label, endpoint, cacheOpts, req)
+	}
+	if useCache {
+		cacheTTL := cache.DefaultTTL
+		if ttl := readSetting("CACHE_TTL"); ttl != "" {
+			cacheTTL, err = time.ParseDuration(ttl)
+			if err != nil {
+				log.Printf("Invalid CACHE_TTL setting %q, it has to be a duration such as 12h\n", ttl)
+				os.Exit(1)
+			}
+		}
 
-	p = tearaw.NewProgram(tea.InitialModel(cmds, runMode == "local"))
-	wg.Add(1)
+		if !*noCachePtr {
+			cachedEntry, cached, err = cache.Load(cacheKey, cacheTTL)
+			if err != nil {
+				log.Printf("Warning: Failed to read the response cache. Error: %v", err)
+			}
+		}
+	}
+
+	// The provider is only set up if the answer is not cached
+	var provider llms.Provider
+	var answeredBy string
+	if !cached {
+		provider, err = primaryProvider(runMode, flags, withRetry, *recordPtr, func(name string) {
+			answeredBy = name
+			p.Send(tea.AnsweredByMsg(name))
+		})
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// Run the Bubble Tea program
+	cmds := new([]string)
+	ctx, cancel, wg := startTUI(tea.InitialModel(cmds, runMode == "local"))
+	defer cancel()
 
 	// Properly close the program if something goes wrong
 	defer p.Quit()
 
+	// Show errors inside the TUI, lexido exits once the user saw them
+	fail := func(err error) {
+		p.Send(tea.ErrorMsg{Err: err})
+		wg.Wait()
+		os.Exit(1)
+	}
+
+	var chunks <-chan llms.Chunk
+	if cached {
+		p.Send(tea.AnsweredByMsg(fmt.Sprintf("the cache, saved %s ago", time.Since(cachedEntry.Created).Round(time.Second))))
+		chunks = cachedChunks(cachedEntry)
+	} else {
+		chunks, err = provider.Stream(ctx, req)
+	}
+	if err != nil && ctx.Err() == nil {
+		fail(fmt.Errorf("Error generating content: %w", err))
+	}
+
+	var responseContent string
+	var response cache.Entry
+
+	if err == nil {
+		for chunk := range chunks {
+			if chunk.Err != nil {
+				if ctx.Err() != nil {
+					break // The user quit, the error is just the stream being torn down
+				}
+				fail(fmt.Errorf("An error occurred: %w", chunk.Err))
+			}
+			if len(chunk.Commands) > 0 {
+				p.Send(tea.CommandsMsg(chunk.Commands))
+				response.Commands = append(response.Commands, chunk.Commands...)
+
+				// Keep the suggested commands in the conversation so follow-up prompts can refer to them
+				for _, cmd := range chunk.Commands {
+					responseContent += "\nSuggested command: " + cmd.Command
+				}
+				continue
+			}
+			responseContent += chunk.Text
+			response.Text += chunk.Text
+			p.Send(tea.AppendResponseMsg(chunk.Text))
+		}
+	}
+
+	p.Send(tea.GenerationDoneMsg{})
+
+	// Only complete responses of the provider itself are cached, not the ones the user quit before they were done
+	// or the ones a fallback provider gave, which would otherwise be replayed as if the provider had answered
+	if useCache && !cached && ctx.Err() == nil && responseContent != "" && (answeredBy == "" || answeredBy == label) {
+		response.Created = time.Now()
+		err = cache.Save(cacheKey, response)
+		if err != nil {
+			log.Printf("Warning: Failed to cache the response. Error: %v", err)
+		}
+	}
+
+	// Only cache what was actually received, if the user quit before anything arrived the previous conversation is kept
+	if responseContent != "" {
+		history = append(history,
+			llms.Message{Role: llms.RoleUser, Content: text_prompt},
+			llms.Message{Role: llms.RoleAssistant, Content: responseContent},
+		)
+		err = conversation.Save(history)
+		if err != nil {
+			log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+		}
+	}
+
+	wg.Wait()
+
+	// Run the commands
+	commands.RunCommands(*cmds)
+}
+
+// startTUI runs the Bubble Tea program showing model in the background. The returned context is cancelled once the
+// TUI exits, which tears down any generation still in flight, and the wait group is done once it has exited.
+func startTUI(model tearaw.Model) (context.Context, context.CancelFunc, *sync.WaitGroup) {
+	wg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p = tearaw.NewProgram(model)
+	wg.Add(1)
+
 	go func() {
 		defer wg.Done()
+		defer cancel()
 		if _, err := p.Run(); err != nil {
 			log.Printf("Alas, there's been a Bubble Tea error: %v\n", err)
 			os.Exit(1)
 		}
 	}()
 
-	var responseContent string
-	if runMode == "gemini" {
-		iter := gemini.Generate(str_prompt)
-		for {
-			resp, err := iter.Next()
-			if err != nil {
-				if err == iterator.Done {
-					break // End of stream
-				}
-				log.Println("An error occurred:", err)
+	return ctx, cancel, wg
+}
 
-				// Check if the error is due to safety filter activation
-				if strings.Contains(err.Error(), "FinishReasonSafety") {
-					fmt.Println("The content generation was blocked for safety reasons. Please try a different prompt.")
-					fmt.Println(resp.PromptFeedback.BlockReason.String())
-					os.Exit(1)
-				}
+// runModes lists the modes lexido can run in
+var runModes = []string{"gemini", "local", "remote", "openai", "anthropic"}
 
-				var gerr *googleapi.Error
-				if !errors.As(err, &gerr) {
-					log.Printf("error: %s\n", err)
-					os.Exit(1)
-				} else {
-					log.Printf("error details: %s\n", gerr)
-					os.Exit(1)
-				}
+func isRunMode(mode string) bool {
+	for _, m := range runModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
 
-				log.Println(err) // For any other type of error, terminate
-				os.Exit(1)
-			}
+// readSetting reads a setting from the environment, falling back to the keyring
+func readSetting(name string) string {
+	if val := os.Getenv(name); val != "" {
+		return val
+	}
+	val, _ := io.ReadFromKeyring(name)
+	return val
+}
+
+// settingOr returns value if it is set, otherwise it reads the named setting
+func settingOr(value string, name string) string {
+	if value != "" {
+		return value
+	}
+	return readSetting(name)
+}
 
-			for _, part := range resp.Candidates[0].Content.Parts {
-				p.Send(tea.AppendResponseMsg(fmt.Sprintf("%v", part)))
+// readGenerationConfig parses the generation parameters, values not given on the command line are read from the settings
+func readGenerationConfig(temperature, topP, topK, maxTokens string) (llms.GenerationConfig, error) {
+	var gen llms.GenerationConfig
 
-				responseContent += fmt.Sprintf("%v", part)
-			}
-		}
-	} else if runMode == "local" {
-		outputChan, err := ollama.GenerateContentStream(str_prompt)
+	if value := settingOr(temperature, "GEMINI_TEMPERATURE"); value != "" {
+		f, err := strconv.ParseFloat(value, 32)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
+			return gen, fmt.Errorf("invalid temperature %q: %w", value, err)
 		}
+		t := float32(f)
+		gen.Temperature = &t
+	}
 
-		for line := range outputChan {
-			responseContent += line
-			p.Send(tea.AppendResponseMsg(line))
+	if value := settingOr(topP, "GEMINI_TOP_P"); value != "" {
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return gen, fmt.Errorf("invalid top-p %q: %w", value, err)
 		}
+		p := float32(f)
+		gen.TopP = &p
+	}
 
-	} else if runMode == "remote" {
-		outputChan, err := remote.GenerateContentStream(str_prompt)
+	if value := settingOr(topK, "GEMINI_TOP_K"); value != "" {
+		i, err := strconv.ParseInt(value, 10, 32)
 		if err != nil {
-			if strings.Contains(err.Error(), "file not found") {
-				log.Println(err.Error())
-				os.Exit(1)
-			}
-			log.Printf("Error generating content remotely: %v\n", err)
-			os.Exit(1)
+			return gen, fmt.Errorf("invalid top-k %q: %w", value, err)
 		}
+		k := int32(i)
+		gen.TopK = &k
+	}
 
-		for line := range outputChan {
-			responseContent += line
-			p.Send(tea.AppendResponseMsg(line))
+	if value := settingOr(maxTokens, "GEMINI_MAX_OUTPUT_TOKENS"); value != "" {
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return gen, fmt.Errorf("invalid maximum output tokens %q: %w", value, err)
 		}
+		m := int32(i)
+		gen.MaxOutputTokens = &m
+	}
 
-	} else {
-		log.Println("Invalid mode. Please use 'gemini', 'local', or 'remote'.")
-		os.Exit(1)
+	return gen, nil
+}
+
+// readTimeouts reads the timeouts from the settings, they are durations such as 30s or 2m and 0 disables a timeout
+func readTimeouts() (llms.Timeouts, error) {
+	timeouts := llms.Timeouts{
+		Connect:    10 * time.Second,
+		FirstToken: 5 * time.Minute,
+		Idle:       time.Minute,
 	}
 
-	p.Send(tea.GenerationDoneMsg{})
+	settings := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"TIMEOUT_CONNECT", &timeouts.Connect},
+		{"TIMEOUT_FIRST_TOKEN", &timeouts.FirstToken},
+		{"TIMEOUT_IDLE", &timeouts.Idle},
+	}
+	for _, setting := range settings {
+		value := readSetting(setting.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return timeouts, fmt.Errorf("invalid %s %q, it has to be a duration such as 30s or 2m", setting.name, value)
+		}
+		*setting.value = d
+	}
+
+	return timeouts, nil
+}
 
-	err = io.CacheConversation(text_prompt + "\n" + responseContent)
+// responseCacheKey returns the key a response is cached under, it covers everything that influences the response.
+// endpoint describes the API that answers if the options alone do not, such as a remote profile.
+func responseCacheKey(label string, endpoint string, opts llms.Options, req llms.Request) string {
+	generation, _ := json.Marshal(opts.Generation)
+	history, _ := json.Marshal(req.History)
+	return cache.Key(
+		label,
+		endpoint,
+		opts.Model,
+		opts.BaseURL,
+		opts.Template,
+		opts.Safety,
+		string(generation),
+		req.System,
+		string(history),
+		req.Prompt,
+		strconv.FormatBool(req.CommandTool),
+	)
+}
+
+// remoteEndpoint describes the remote profile that answers, its name and its whole configuration, so that switching
+// the default profile or editing the profile's URL, template or model does not replay the answer of another endpoint
+func remoteEndpoint(profile string) (string, error) {
+	config, err := remote.LoadConfig()
 	if err != nil {
-		log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+		return "", err
+	}
+	api, err := config.Profile(profile)
+	if err != nil {
+		return "", err
+	}
+	if profile == "" {
+		profile = config.DefaultProfile
 	}
 
-	wg.Wait()
+	data, err := json.Marshal(api)
+	if err != nil {
+		return "", err
+	}
+	return profile + "\n" + string(data), nil
+}
 
-	// Run the commands
-	commands.RunCommands(*cmds)
+// cachedChunks streams a cached response the same way a provider would
+func cachedChunks(entry cache.Entry) <-chan llms.Chunk {
+	chunks := make(chan llms.Chunk, 2)
+	if entry.Text != "" {
+		chunks <- llms.Chunk{Text: entry.Text}
+	}
+	if len(entry.Commands) > 0 {
+		chunks <- llms.Chunk{Commands: entry.Commands}
+	}
+	close(chunks)
+	return chunks
+}
+
+// localBackends lists the providers that can serve the local mode, the first one is the default
+var localBackends = []string{"ollama", "llamacpp"}
+
+// providerName maps a run mode to the name of the provider that serves it
+func providerName(runMode string) string {
+	if runMode == "local" {
+		if backend := readSetting("LOCAL_BACKEND"); backend != "" {
+			return backend
+		}
+		return localBackends[0]
+	}
+	return runMode
 }
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const cacheDir = "cache"
+
+// DefaultTTL is how long a cached response is used when no CACHE_TTL is set
+const DefaultTTL = 24 * time.Hour
+
+// Entry is a cached response
+type Entry struct {
+	Created  time.Time          `json:"created"`
+	Text     string             `json:"text"`
+	Commands []commands.Command `json:"commands,omitempty"`
+}
+
+// Key hashes everything that influences a response, such as the provider, model, pre-prompt and prompt, into the key of its entry
+func Key(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		// Prefix every part with its length so that moving text from one part to the next changes the key
+		binary.Write(hash, binary.BigEndian, uint64(len(part)))
+		hash.Write([]byte(part))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Load returns the entry stored under key if it is younger than ttl
+func Load(key string, ttl time.Duration) (Entry, bool, error) {
+	filePath, err := entryPath(key)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return Entry{}, false, err
+	}
+
+	if time.Since(entry.Created) > ttl {
+		// Expired entries are removed so the cache does not grow forever
+		os.Remove(filePath)
+		return Entry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// Save stores the entry under key, replacing the previous one
+func Save(key string, entry Entry) error {
+	filePath, err := entryPath(key)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the cache directory exists
+	err = os.MkdirAll(filepath.Dir(filePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0600)
+}
+
+func entryPath(key string) (string, error) {
+	return io.GetFilePath(filepath.Join(cacheDir, key+".json"))
+}
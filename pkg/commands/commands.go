@@ -8,6 +8,39 @@ import (
 	"strings"
 )
 
+// Command is a command suggested by the model along with what is known about it
+type Command struct {
+	Command      string `json:"command"`
+	Explanation  string `json:"explanation,omitempty"`
+	RequiresRoot bool   `json:"requires_root,omitempty"`
+	Risk         string `json:"risk,omitempty"` // low, medium or high, empty if the model did not say
+}
+
+// Risk levels a model can assign to a command
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// FromStrings wraps plain commands, such as the ones found by ParseCommands, without any metadata
+func FromStrings(commands []string) []Command {
+	wrapped := make([]Command, 0, len(commands))
+	for _, command := range commands {
+		wrapped = append(wrapped, Command{Command: command})
+	}
+	return wrapped
+}
+
+// Strings returns just the command lines
+func Strings(commands []Command) []string {
+	plain := make([]string, 0, len(commands))
+	for _, command := range commands {
+		plain = append(plain, command.Command)
+	}
+	return plain
+}
+
 // Regular expression to find @run[<COMMAND>]
 var commandRegex = regexp.MustCompile(`@run\[(.*?)\]`)
 
@@ -58,9 +91,19 @@ func RunCommands(commands []string) {
 }
 
 // Function to detect if any of the commands are being ran as sudo
-func ContainsSudo(commands []string) bool {
-	for _, cmdStr := range commands {
-		if strings.HasPrefix(cmdStr, "sudo") {
+func ContainsSudo(commands []Command) bool {
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd.Command, "sudo") || cmd.RequiresRoot {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to detect if the model marked any of the commands as high risk
+func ContainsHighRisk(commands []Command) bool {
+	for _, cmd := range commands {
+		if cmd.Risk == RiskHigh {
 			return true
 		}
 	}
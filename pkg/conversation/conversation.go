@@ -0,0 +1,94 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+const cacheFile = "lexido_conversation.json"
+
+// legacyCacheFile is where lexido used to keep the conversation as plain text before it was stored by turn
+const legacyCacheFile = "lexido_conversation_cache.txt"
+
+// Load reads the turns of the previous conversation from the cache
+func Load() ([]llms.Message, error) {
+	filePath, err := io.GetFilePath(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return loadLegacy(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []llms.Message
+	if err := json.Unmarshal(content, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Save writes the turns of the conversation to the cache, replacing the previous conversation
+func Save(messages []llms.Message) error {
+	filePath, err := io.GetFilePath(cacheFile)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the .lexido directory exists
+	err = os.MkdirAll(filepath.Dir(filePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(messages, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filePath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	// The conversation of the plain text cache is part of the one just saved if it was continued, drop the old file
+	legacyPath, err := io.GetFilePath(legacyCacheFile)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(legacyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// loadLegacy reads the conversation from the plain text cache of older versions as a single user turn,
+// notExist is returned if there is none either
+func loadLegacy(notExist error) ([]llms.Message, error) {
+	filePath, err := io.GetFilePath(legacyCacheFile)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, notExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return nil, notExist
+	}
+	return []llms.Message{{Role: llms.RoleUser, Content: string(content)}}, nil
+}
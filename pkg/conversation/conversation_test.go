@@ -0,0 +1,61 @@
+package conversation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+func TestLoadImportsLegacyCache(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	legacy := filepath.Join(home, ".lexido", legacyCacheFile)
+	if err := os.MkdirAll(filepath.Dir(legacy), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("list files\n\nYou can use @run ls"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if len(messages) != 1 || messages[0].Role != llms.RoleUser || messages[0].Content != "list files\n\nYou can use @run ls" {
+		t.Fatalf("Load = %+v, want the old conversation as a single user turn", messages)
+	}
+
+	messages = append(messages,
+		llms.Message{Role: llms.RoleUser, Content: "only the hidden ones"},
+		llms.Message{Role: llms.RoleAssistant, Content: "You can use @run ls -d .*"},
+	)
+	if err := Save(messages); err != nil {
+		t.Fatalf("Save returned %v", err)
+	}
+	if _, err := os.Stat(legacy); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the old cache is still there after saving, Stat returned %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if len(loaded) != 3 || loaded[2].Content != "You can use @run ls -d .*" {
+		t.Errorf("Load = %+v, want the saved conversation", loaded)
+	}
+}
+
+func TestLoadWithoutCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if _, err := Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load returned %v, want a missing file error", err)
+	}
+	if err := Save([]llms.Message{{Role: llms.RoleUser, Content: "hi"}}); err != nil {
+		t.Errorf("Save returned %v without an old cache to remove", err)
+	}
+}
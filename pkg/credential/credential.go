@@ -0,0 +1,175 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const credentialDir = "credentials"
+
+// expiryMargin is how long before its stated expiry a token is already refreshed, so it does not expire mid request
+const expiryMargin = 30 * time.Second
+
+// Helper runs a credential command to get a token and caches the token until it expires, like git's credential helpers
+type Helper struct {
+	command string
+}
+
+// Token is a token printed by a credential command
+type Token struct {
+	Token   string    `json:"token"`
+	Type    string    `json:"token_type,omitempty"` // Such as "Bearer", empty if the command printed a bare token
+	Expires time.Time `json:"expires_at"`           // Zero if the command did not state an expiry, such tokens are not cached
+}
+
+// Bearer reports whether the token is an OAuth bearer token rather than an API key
+func (t Token) Bearer() bool {
+	return strings.EqualFold(t.Type, "bearer")
+}
+
+// output is the JSON a credential command may print instead of a bare token
+type output struct {
+	Token       string    `json:"token"`
+	AccessToken string    `json:"access_token"` // As printed by OAuth token endpoints
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ExpiresIn   int64     `json:"expires_in"` // Seconds from now
+}
+
+// New returns a helper for the shell command
+func New(command string) *Helper {
+	return &Helper{command: command}
+}
+
+// Token returns the cached token if it did not expire yet, otherwise it runs the command for a fresh one
+func (h *Helper) Token(ctx context.Context) (Token, error) {
+	if token, ok := h.load(); ok {
+		return token, nil
+	}
+
+	token, err := h.run(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if !token.Expires.IsZero() {
+		if err := h.save(token); err != nil {
+			return Token{}, fmt.Errorf("failed to cache the credential: %w", err)
+		}
+	}
+	return token, nil
+}
+
+// Invalidate forgets the cached token, for example after the server rejected it
+func (h *Helper) Invalidate() {
+	if filePath, err := h.path(); err == nil {
+		os.Remove(filePath)
+	}
+}
+
+// run runs the command and parses what it prints
+func (h *Helper) run(ctx context.Context) (Token, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	data, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return Token{}, fmt.Errorf("credential command failed: %w: %s", err, message)
+		}
+		return Token{}, fmt.Errorf("credential command failed: %w", err)
+	}
+
+	return parse(data, time.Now())
+}
+
+// parse reads the output of a credential command, either a bare token or a JSON object with the token and its expiry
+func parse(data []byte, now time.Time) (Token, error) {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		token := string(trimmed)
+		if token == "" || strings.Contains(token, "\n") {
+			return Token{}, errors.New("credential command has to print a single token or a JSON object")
+		}
+		return Token{Token: token}, nil
+	}
+
+	var out output
+	if err := json.Unmarshal(trimmed, &out); err != nil {
+		return Token{}, fmt.Errorf("failed to decode the output of the credential command: %w", err)
+	}
+
+	token := Token{Token: out.Token, Type: out.TokenType, Expires: out.ExpiresAt}
+	if token.Token == "" {
+		token.Token = out.AccessToken
+	}
+	if token.Token == "" {
+		return Token{}, errors.New("the output of the credential command has no token")
+	}
+	if out.ExpiresIn > 0 {
+		token.Expires = now.Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// load returns the cached token of the command if it is still valid
+func (h *Helper) load() (Token, bool) {
+	filePath, err := h.path()
+	if err != nil {
+		return Token{}, false
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return Token{}, false
+	}
+
+	var token Token
+	if err := json.Unmarshal(content, &token); err != nil || token.Token == "" {
+		return Token{}, false
+	}
+
+	if time.Now().Add(expiryMargin).After(token.Expires) {
+		os.Remove(filePath)
+		return Token{}, false
+	}
+	return token, true
+}
+
+func (h *Helper) save(token Token) error {
+	filePath, err := h.path()
+	if err != nil {
+		return err
+	}
+
+	// Ensure the credentials directory exists
+	err = os.MkdirAll(filepath.Dir(filePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0600)
+}
+
+// path returns the file the token of the command is cached in, it is named after a hash of the command
+func (h *Helper) path() (string, error) {
+	hash := sha256.Sum256([]byte(h.command))
+	return io.GetFilePath(filepath.Join(credentialDir, hex.EncodeToString(hash[:])+".json"))
+}
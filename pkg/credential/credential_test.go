@@ -0,0 +1,138 @@
+package credential
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		output  string
+		want    Token
+		wantErr string
+	}{
+		{
+			name:   "bare token",
+			output: "sk-abc123\n",
+			want:   Token{Token: "sk-abc123"},
+		},
+		{
+			name:   "token with expires_at",
+			output: `{"token": "sk-abc123", "expires_at": "2024-05-01T13:00:00Z"}`,
+			want:   Token{Token: "sk-abc123", Expires: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "OAuth access token",
+			output: `{"access_token": "ya29.abc", "token_type": "Bearer", "expires_in": 3599}`,
+			want:   Token{Token: "ya29.abc", Type: "Bearer", Expires: now.Add(3599 * time.Second)},
+		},
+		{
+			name:    "multi-line output",
+			output:  "sk-abc123\nsk-def456\n",
+			wantErr: "single token",
+		},
+		{
+			name:    "empty output",
+			output:  "  \n",
+			wantErr: "single token",
+		},
+		{
+			name:    "JSON without a token",
+			output:  `{"expires_in": 3599}`,
+			wantErr: "has no token",
+		},
+		{
+			name:    "invalid JSON",
+			output:  `{"token": `,
+			wantErr: "failed to decode",
+		},
+	}
+	for _, test := range tests {
+		got, err := parse([]byte(test.output), now)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: parse returned %+v, %v, want an error containing %q", test.name, got, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parse returned %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s: parse = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// countingCommand returns a credential command that prints a new token on every run, such as tok-1 and tok-2,
+// with expiry added to the JSON it prints
+func countingCommand(t *testing.T, expiry string) string {
+	counter := filepath.Join(t.TempDir(), "runs")
+	return `n=$(( $(cat ` + counter + ` 2>/dev/null || echo 0) + 1 )); echo $n > ` + counter + `; printf '{"token": "tok-%s"` + expiry + `}' $n`
+}
+
+func TestHelperCachesTokenUntilInvalidated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	helper := New(countingCommand(t, `, "expires_in": 3600`))
+	ctx := context.Background()
+
+	for _, want := range []string{"tok-1", "tok-1"} {
+		token, err := helper.Token(ctx)
+		if err != nil {
+			t.Fatalf("Token returned %v", err)
+		}
+		if token.Token != want {
+			t.Errorf("token = %q, want the cached %q", token.Token, want)
+		}
+	}
+
+	filePath, err := helper.path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filePath); err != nil {
+		t.Errorf("the token was not cached: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("cached token file has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	helper.Invalidate()
+	token, err := helper.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token returned %v", err)
+	}
+	if token.Token != "tok-2" {
+		t.Errorf("token after Invalidate = %q, want the fresh tok-2", token.Token)
+	}
+}
+
+func TestHelperDoesNotCacheTokenWithoutExpiry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	helper := New(countingCommand(t, ""))
+
+	for _, want := range []string{"tok-1", "tok-2"} {
+		token, err := helper.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token returned %v", err)
+		}
+		if token.Token != want {
+			t.Errorf("token = %q, want %q", token.Token, want)
+		}
+	}
+}
+
+func TestHelperReportsFailingCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	helper := New("echo 'not logged in' >&2; exit 1")
+
+	_, err := helper.Token(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Errorf("Token returned %v, want the error the command printed", err)
+	}
+}
@@ -1,6 +1,14 @@
 package format
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ansiCode matches the color codes used in the TUI
+var ansiCode = regexp.MustCompile("\033\\[[0-9;]*m")
 
 func WrapText(text string, lineWidth int) string {
 	// Split the text into paragraphs based on newline characters
@@ -42,6 +50,47 @@ func WrapParagraph(paragraph string, lineWidth int) string {
 	return result.String()
 }
 
+// WrapColumn wraps text into the lines of a column. A color that spans a line break is reset at the end of the line
+// and picked up again on the next one, so it does not bleed into the neighbouring column.
+func WrapColumn(text string, width int) []string {
+	lines := strings.Split(WrapText(text, width), "\n")
+	active := ""
+	for i, line := range lines {
+		line = active + line
+		if codes := ansiCode.FindAllString(line, -1); len(codes) > 0 {
+			active = codes[len(codes)-1]
+			if active == "\033[0m" {
+				active = ""
+			}
+		}
+		if active != "" {
+			line += "\033[0m"
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// VisibleWidth returns the number of characters text takes up on the terminal, leaving out color codes
+func VisibleWidth(text string) int {
+	return utf8.RuneCountInString(ansiCode.ReplaceAllString(text, ""))
+}
+
 func TrimWhitespace(text string) string {
 	return strings.TrimSpace(text)
 }
+
+// FormatBytes formats a size the way ollama shows it, such as 4.7 GB
+func FormatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	unit := 0
+	for size >= 1000 && unit < len(units)-1 {
+		size /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
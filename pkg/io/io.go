@@ -13,44 +13,8 @@ import (
 )
 
 const cacheDir = ".lexido"
-const cacheFile = "lexido_conversation_cache.txt"
 const keyringFile = "keyring.json"
 
-// Writes conversation to cache file
-func CacheConversation(conversation string) error {
-	filePath, err := GetFilePath(cacheFile)
-	if err != nil {
-		return err
-	}
-
-	// Ensure the .lexido directory exists
-	err = ensureDirForFile(filePath)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filePath, []byte(conversation), 0644)
-}
-
-// Reads conversation from cache file
-func ReadConversationCache() (string, error) {
-	filePath, err := GetFilePath(cacheFile)
-	if err != nil {
-		return "", err
-	}
-
-	// Ensure the .lexido directory exists
-	err = ensureDirForFile(filePath)
-	if err != nil {
-		return "", err
-	}
-
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", err
-	}
-	return string(content), nil
-}
-
 func ensureDirForFile(filePath string) error {
 	return os.MkdirAll(filepath.Dir(filePath), 0700)
 }
@@ -77,6 +41,15 @@ func ReadPipedInput() (string, error) {
 	return "", nil // No piped data
 }
 
+// StdinIsTerminal reports whether the user can be asked questions on stdin
+func StdinIsTerminal() bool {
+	fileInfo, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
 func GetFilePath(file string) (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -246,6 +219,12 @@ Usage:
 
 	To run llama3 locally via ollama:
 		lexido -l -m llama3 "install teamspeak via docker"
+
+	To list the models available for the current mode:
+		lexido -l models
+
+	To compare the answers of gemini and a local model side by side:
+		lexido --compare gemini,local "install teamspeak via docker"
     
 Options:
     -h, --help          Display help information
@@ -254,9 +233,24 @@ Options:
 	-g   				Temporarily run via gemini
 	-l 					Temporarily run locally via ollama
 	-r 					Temporarily run via remote
-	-m string			Temporarily run with a model to be used by ollama
+	-p string			Temporarily run via remote with the given profile from the configuration file
+	-o 					Temporarily run via an OpenAI compatible API
+	-a 					Temporarily run via the Anthropic API
+	-m string			Temporarily run with a model to be used by gemini, ollama, the remote API, the OpenAI compatible API or Anthropic
+	--temperature float	Temporarily run gemini with the given sampling temperature
+	--topP float		Temporarily run gemini with the given top-p value
+	--topK int			Temporarily run gemini with the given top-k value
+	--maxTokens int		Temporarily limit the number of tokens gemini generates
+	--safety string		Temporarily run gemini with the given safety thresholds (none, high, medium, low)
+	--retries int		Temporarily retry rate limited or failed requests the given number of times
+	--structured		Temporarily ask for commands as structured tool calls instead of @run[...] when the provider supports it
+	--no-cache		Temporarily ask the provider even if the response is cached
+	--compare string	Ask several providers at once and show their answers side by side, such as gemini,local,remote:groq
+	--record string		Save the streamed response to the given fixture file
+	--replay string		Replay a fixture file saved with --record instead of asking a model, no network is needed
 	--setModel string	Set the default model to be used by ollama
-	--setDefault string	Set the default mode for lexido to run in (gemini, local, remote)
+	--setDefault string	Set the default mode for lexido to run in (gemini, local, remote, openai, anthropic)
+	--setFallback string	Set the providers to fall back to in order when the default one fails, such as local,remote:groq (none to disable)
 
 Note: Lexido's outputs may not always be factual. User discretion is advised.`)
 }
@@ -0,0 +1,248 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+const DefaultBaseURL = "https://api.anthropic.com"
+const DefaultModel = "claude-3-5-haiku-latest"
+
+const apiVersion = "2023-06-01"
+const maxTokens = 4096
+
+func init() {
+	llms.Register("anthropic", func() llms.Provider { return &Provider{} })
+}
+
+// Provider generates responses through the Anthropic Messages API
+type Provider struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+// messagesRequest is the body sent to /v1/messages
+type messagesRequest struct {
+	Model     string         `json:"model"`
+	MaxTokens int            `json:"max_tokens"`
+	System    string         `json:"system,omitempty"`
+	Messages  []llms.Message `json:"messages"`
+	Stream    bool           `json:"stream"`
+	Tools     []tool         `json:"tools,omitempty"`
+}
+
+// tool describes a tool the model can use
+type tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+// streamEvent is the payload of a single streamed event, only the fields lexido uses are decoded
+type streamEvent struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *Provider) Setup(opts llms.Options) error {
+	p.baseURL = strings.TrimRight(opts.BaseURL, "/")
+	if p.baseURL == "" {
+		p.baseURL = DefaultBaseURL
+	}
+	p.model = opts.Model
+	if p.model == "" {
+		p.model = DefaultModel
+	}
+	p.apiKey = opts.APIKey
+	var err error
+	p.client, err = llms.NewHTTPClient(opts)
+	return err
+}
+
+func (p *Provider) Validate() error {
+	if p.apiKey == "" {
+		return errors.New("no Anthropic API key set, please set ANTHROPIC_API_KEY")
+	}
+	return nil
+}
+
+// modelsResponse is the body returned by /v1/models
+type modelsResponse struct {
+	Data []struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
+}
+
+// Models returns the models offered by the API
+func (p *Provider) Models(ctx context.Context) ([]llms.Model, error) {
+	var models []llms.Model
+	afterID := ""
+	for {
+		query := url.Values{"limit": {"1000"}}
+		if afterID != "" {
+			query.Set("after_id", afterID)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("x-api-key", p.apiKey)
+		req.Header.Set("anthropic-version", apiVersion)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var list modelsResponse
+		err = llms.CheckResponse(resp)
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&list)
+			if err != nil {
+				err = fmt.Errorf("failed to decode model list: %w", err)
+			}
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range list.Data {
+			models = append(models, llms.Model{Name: m.ID, Modified: m.CreatedAt})
+		}
+
+		// The list is paginated, keep going until the last page
+		if !list.HasMore || list.LastID == "" {
+			return models, nil
+		}
+		afterID = list.LastID
+	}
+}
+
+func (p *Provider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	messagesReq := messagesRequest{
+		Model:     p.model,
+		MaxTokens: maxTokens,
+		System:    req.CommandToolSystem(),
+		Messages:  req.Messages(),
+		Stream:    true,
+	}
+	if req.CommandTool {
+		messagesReq.Tools = []tool{{
+			Name:        llms.CommandToolName,
+			Description: llms.CommandToolDescription,
+			InputSchema: llms.CommandToolSchema,
+		}}
+	}
+
+	body, err := json.Marshal(messagesReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", apiVersion)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := llms.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	outputChan := make(chan llms.Chunk)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(outputChan)
+
+		// The input of a tool_use block is streamed as partial JSON, it is collected by block and decoded once the block stops
+		toolInputs := make(map[int]*strings.Builder)
+
+		err := llms.ReadSSE(resp.Body, func(event llms.Event) error {
+			var e streamEvent
+			if err := json.Unmarshal([]byte(event.Data), &e); err != nil {
+				return fmt.Errorf("failed to decode stream event: %w", err)
+			}
+
+			switch e.Type {
+			case "content_block_start":
+				if e.ContentBlock.Type == "tool_use" && e.ContentBlock.Name == llms.CommandToolName {
+					toolInputs[e.Index] = &strings.Builder{}
+				}
+			case "content_block_delta":
+				if e.Delta.Type == "input_json_delta" {
+					if input, ok := toolInputs[e.Index]; ok {
+						input.WriteString(e.Delta.PartialJSON)
+					}
+					return nil
+				}
+				if e.Delta.Type != "text_delta" || e.Delta.Text == "" {
+					return nil
+				}
+				if !llms.Send(ctx, outputChan, llms.Chunk{Text: e.Delta.Text}) {
+					return ctx.Err()
+				}
+			case "content_block_stop":
+				input, ok := toolInputs[e.Index]
+				if !ok {
+					return nil
+				}
+				cmds, err := llms.ParseCommandToolArgs([]byte(input.String()))
+				if err != nil {
+					return err
+				}
+				if !llms.Send(ctx, outputChan, llms.Chunk{Commands: cmds}) {
+					return ctx.Err()
+				}
+			case "message_stop":
+				return llms.ErrEndOfStream
+			case "error":
+				return errors.New(e.Error.Type + ": " + e.Error.Message)
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			llms.Send(ctx, outputChan, llms.Chunk{Err: err})
+		}
+	}()
+
+	return outputChan, nil
+}
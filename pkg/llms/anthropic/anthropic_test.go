@@ -0,0 +1,204 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"github.com/micr0-dev/lexido/pkg/llms/llmstest"
+)
+
+// textStream is a recorded response streaming a text answer, the events after message_stop must be ignored
+const textStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","content":[],"model":"claude-3-5-haiku-latest","stop_reason":null,"usage":{"input_tokens":25,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Use "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ls -la"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":5}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" after stop"}}
+
+`
+
+// errorStream is a recorded response the API aborted with an error event
+const errorStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_02","type":"message","role":"assistant","content":[]}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Par"}}
+
+event: error
+data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}
+
+`
+
+// toolStream is a recorded response calling the command tool, its input arrives in pieces split mid-token
+const toolStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_03","type":"message","role":"assistant","content":[]}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Here you go."}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"suggest_commands","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"commands\": [{\"comm"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"and\": \"df -h\", \"explanation\": \"Show disk usage\", "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"risk\": \"LOW\"}]}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+// newTestProvider returns a provider talking to a stub server that replays the recorded stream, the request it got is stored in got
+func newTestProvider(t *testing.T, stream string, got *messagesRequest) *Provider {
+	t.Helper()
+	server := llmstest.Server(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("request to %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != apiVersion {
+			t.Errorf("request headers are %v, want the API key and version", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("failed to decode the request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, stream)
+	})
+
+	p := &Provider{}
+	if err := p.Setup(llms.Options{APIKey: "test-key", BaseURL: server.URL + "/"}); err != nil {
+		t.Fatalf("Setup returned %v", err)
+	}
+	return p
+}
+
+func TestStreamText(t *testing.T) {
+	var got messagesRequest
+	p := newTestProvider(t, textStream, &got)
+
+	chunks, err := p.Stream(context.Background(), llms.Request{
+		System:  "You are lexido",
+		History: []llms.Message{{Role: llms.RoleUser, Content: "hi"}, {Role: llms.RoleAssistant, Content: "hello"}},
+		Prompt:  "list files",
+	})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if err != nil {
+		t.Errorf("stream failed with %v", err)
+	}
+	if text != "Use ls -la" {
+		t.Errorf("text = %q, want %q", text, "Use ls -la")
+	}
+
+	if got.System != "You are lexido" {
+		t.Errorf("system = %q, want the system prompt", got.System)
+	}
+	want := []llms.Message{
+		{Role: llms.RoleUser, Content: "hi"},
+		{Role: llms.RoleAssistant, Content: "hello"},
+		{Role: llms.RoleUser, Content: "list files"},
+	}
+	if fmt.Sprint(got.Messages) != fmt.Sprint(want) {
+		t.Errorf("messages = %v, want %v without the system prompt", got.Messages, want)
+	}
+	if !got.Stream || got.Model != DefaultModel || len(got.Tools) != 0 {
+		t.Errorf("request for model %q with stream %v and %d tools, want the default model streamed without tools", got.Model, got.Stream, len(got.Tools))
+	}
+}
+
+func TestStreamErrorEvent(t *testing.T) {
+	var got messagesRequest
+	p := newTestProvider(t, errorStream, &got)
+
+	chunks, err := p.Stream(context.Background(), llms.Request{Prompt: "list files"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if text != "Par" {
+		t.Errorf("text = %q, want %q", text, "Par")
+	}
+	if err == nil || err.Error() != "overloaded_error: Overloaded" {
+		t.Errorf("stream error = %v, want the error of the event", err)
+	}
+}
+
+func TestStreamToolUse(t *testing.T) {
+	var got messagesRequest
+	p := newTestProvider(t, toolStream, &got)
+
+	chunks, err := p.Stream(context.Background(), llms.Request{System: "You are lexido", Prompt: "disk usage", CommandTool: true})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, cmds, err := llmstest.Collect(chunks)
+	if err != nil {
+		t.Errorf("stream failed with %v", err)
+	}
+	if text != "Here you go." {
+		t.Errorf("text = %q, want %q", text, "Here you go.")
+	}
+	want := []commands.Command{{Command: "df -h", Explanation: "Show disk usage", Risk: commands.RiskLow}}
+	if fmt.Sprint(cmds) != fmt.Sprint(want) {
+		t.Errorf("commands = %+v, want %+v", cmds, want)
+	}
+
+	if len(got.Tools) != 1 || got.Tools[0].Name != llms.CommandToolName {
+		t.Errorf("request tools = %+v, want the command tool", got.Tools)
+	}
+	if !strings.HasPrefix(got.System, "You are lexido ") {
+		t.Errorf("system = %q, want the system prompt with the command tool instructions", got.System)
+	}
+}
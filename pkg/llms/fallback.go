@@ -0,0 +1,80 @@
+package llms
+
+import (
+	"context"
+	"errors"
+)
+
+// Candidate is a provider that is part of a fallback chain
+type Candidate struct {
+	Name     string // Name shown to the user, such as "local" or "remote:groq"
+	Provider Provider
+
+	// Connect sets up and validates the provider if Provider is nil. It is only called once the candidates before it
+	// failed, so a provider that is never needed costs nothing.
+	Connect func() (Provider, error)
+}
+
+// FallbackHooks are called by a fallback chain to report what it is doing, both may be nil
+type FallbackHooks struct {
+	OnFallback func(failed string, err error, next string) // Called when a provider failed and the next one is tried
+	OnAnswer   func(name string)                           // Called once a provider started answering
+}
+
+// fallbackProvider tries its candidates in order until one of them answers
+type fallbackProvider struct {
+	candidates []Candidate
+	hooks      FallbackHooks
+}
+
+// WithFallback chains providers so that the next one is used whenever the previous one fails before answering.
+// Candidates without a Provider are connected to when their turn comes, Setup and Validate of the chain do nothing.
+func WithFallback(candidates []Candidate, hooks FallbackHooks) Provider {
+	return &fallbackProvider{candidates: candidates, hooks: hooks}
+}
+
+func (f *fallbackProvider) Setup(opts Options) error {
+	return nil
+}
+
+func (f *fallbackProvider) Validate() error {
+	if len(f.candidates) == 0 {
+		return errors.New("no provider available")
+	}
+	return nil
+}
+
+func (f *fallbackProvider) Stream(ctx context.Context, req Request) (<-chan Chunk, error) {
+	var err error
+	for i := range f.candidates {
+		candidate := &f.candidates[i]
+		if candidate.Provider == nil {
+			var provider Provider
+			provider, err = candidate.Connect()
+			if err == nil {
+				candidate.Provider = provider
+			}
+		}
+
+		var chunks <-chan Chunk
+		var first *Chunk
+		if candidate.Provider != nil {
+			chunks, first, err = start(ctx, candidate.Provider, req)
+		}
+		if err == nil {
+			if f.hooks.OnAnswer != nil {
+				f.hooks.OnAnswer(candidate.Name)
+			}
+			return forward(ctx, first, chunks), nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if i+1 < len(f.candidates) && f.hooks.OnFallback != nil {
+			f.hooks.OnFallback(candidate.Name, err, f.candidates[i+1].Name)
+		}
+	}
+	return nil, err
+}
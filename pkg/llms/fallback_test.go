@@ -0,0 +1,99 @@
+package llms_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+// stubProvider answers with text, or fails before answering if err is set
+type stubProvider struct {
+	text string
+	err  error
+}
+
+func (p *stubProvider) Setup(opts llms.Options) error { return nil }
+func (p *stubProvider) Validate() error               { return nil }
+
+func (p *stubProvider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	chunks := make(chan llms.Chunk, 1)
+	chunks <- llms.Chunk{Text: p.text}
+	close(chunks)
+	return chunks, nil
+}
+
+// connect returns a Connect func for provider that counts how often it is called, err makes connecting fail
+func connect(provider llms.Provider, err error, calls *int) func() (llms.Provider, error) {
+	return func() (llms.Provider, error) {
+		*calls++
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	}
+}
+
+func TestFallbackConnectsOnlyWhenNeeded(t *testing.T) {
+	var connects int
+	provider := llms.WithFallback([]llms.Candidate{
+		{Name: "gemini", Provider: &stubProvider{text: "from gemini"}},
+		{Name: "local", Connect: connect(&stubProvider{text: "from local"}, nil, &connects)},
+	}, llms.FallbackHooks{})
+
+	chunks, err := provider.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	if chunk := <-chunks; chunk.Text != "from gemini" {
+		t.Errorf("answer = %q, want the one of the primary provider", chunk.Text)
+	}
+	if connects != 0 {
+		t.Errorf("the fallback was connected to %d times although the primary answered", connects)
+	}
+}
+
+func TestFallbackSkipsProvidersThatCannotConnect(t *testing.T) {
+	var localConnects, remoteConnects int
+	var fallbacks []string
+	var answeredBy string
+	provider := llms.WithFallback([]llms.Candidate{
+		{Name: "gemini", Provider: &stubProvider{err: errors.New("quota exceeded")}},
+		{Name: "local", Connect: connect(nil, errors.New("ollama is not running"), &localConnects)},
+		{Name: "remote:groq", Connect: connect(&stubProvider{text: "from groq"}, nil, &remoteConnects)},
+	}, llms.FallbackHooks{
+		OnFallback: func(failed string, err error, next string) {
+			fallbacks = append(fallbacks, fmt.Sprintf("%s (%v) -> %s", failed, err, next))
+		},
+		OnAnswer: func(name string) { answeredBy = name },
+	})
+
+	for range 2 {
+		chunks, err := provider.Stream(context.Background(), llms.Request{Prompt: "hi"})
+		if err != nil {
+			t.Fatalf("Stream returned %v", err)
+		}
+		if chunk := <-chunks; chunk.Text != "from groq" {
+			t.Errorf("answer = %q, want the one of the last fallback", chunk.Text)
+		}
+	}
+
+	if answeredBy != "remote:groq" {
+		t.Errorf("OnAnswer got %q, want remote:groq", answeredBy)
+	}
+	want := []string{
+		"gemini (quota exceeded) -> local",
+		"local (ollama is not running) -> remote:groq",
+	}
+	if fmt.Sprint(fallbacks[:2]) != fmt.Sprint(want) {
+		t.Errorf("fallbacks = %q, want %q", fallbacks[:2], want)
+	}
+	if remoteConnects != 1 {
+		t.Errorf("the working fallback was connected to %d times, want once", remoteConnects)
+	}
+}
@@ -2,23 +2,45 @@ package gemini
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/credential"
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-var model *genai.GenerativeModel
-var ctx context.Context
+const DefaultModel = "gemini-2.0-flash"
+
+func init() {
+	llms.Register("gemini", func() llms.Provider { return &Provider{} })
+}
+
+// Provider generates responses through the Gemini API
+type Provider struct {
+	apiKey     string             // API key or bearer token the client was set up with
+	credential *credential.Helper // Set if the API key or token is printed by a credential command
+	opts       llms.Options
+	client     *genai.Client
+	model      *genai.GenerativeModel
+}
 
 func IsKeyValid(apiKey string) (bool, error) {
-	if Setup(apiKey) != nil {
+	p := &Provider{}
+	if p.Setup(llms.Options{APIKey: apiKey}) != nil {
 		return false, nil
 	}
 
 	prompt := genai.Text("Say Hello World!")
-	_, err := model.GenerateContent(ctx, prompt)
+	_, err := p.model.GenerateContent(context.Background(), prompt)
 
 	if err != nil {
 		// Check if the error contains invalid API key (Error 400)
@@ -31,44 +53,278 @@ func IsKeyValid(apiKey string) (bool, error) {
 	return true, nil
 }
 
-func Setup(apiKey string) error {
-	ctx = context.Background()
+func (p *Provider) Setup(opts llms.Options) error {
+	p.opts = opts
+	if opts.CredentialCommand != "" {
+		// The key is only fetched once it is needed
+		p.credential = credential.New(opts.CredentialCommand)
+		return nil
+	}
+	p.apiKey = opts.APIKey
+	return p.connect(option.WithAPIKey(opts.APIKey))
+}
+
+// connect sets up the GenAI client and model with the given authentication
+func (p *Provider) connect(auth option.ClientOption) error {
+	opts := p.opts
 
 	// Set up the GenAI client
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	client, err := genai.NewClient(context.Background(), auth)
 	if err != nil {
 		return err
 	}
 
-	// Call Gemini Pro with the user's prompt
-	model = client.GenerativeModel("gemini-2.0-flash")
+	modelName := opts.Model
+	if modelName == "" {
+		modelName = DefaultModel
+	}
+	p.client = client
+	p.model = client.GenerativeModel(modelName)
 
-	model.SetTemperature(0.7)
-	model.SetTopK(1)
+	gen := opts.Generation
+	if gen.Temperature != nil {
+		p.model.SetTemperature(*gen.Temperature)
+	} else {
+		p.model.SetTemperature(0.7)
+	}
+	if gen.TopK != nil {
+		p.model.SetTopK(*gen.TopK)
+	} else {
+		p.model.SetTopK(1)
+	}
+	if gen.TopP != nil {
+		p.model.SetTopP(*gen.TopP)
+	}
+	if gen.MaxOutputTokens != nil {
+		p.model.SetMaxOutputTokens(*gen.MaxOutputTokens)
+	}
 
-	model.SafetySettings = []*genai.SafetySetting{
-		{
-			Category:  genai.HarmCategoryHarassment,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategoryHateSpeech,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategorySexuallyExplicit,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategoryDangerousContent,
-			Threshold: genai.HarmBlockNone,
-		},
+	p.model.SafetySettings, err = parseSafety(opts.Safety)
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func Generate(str_prompt string) *genai.GenerateContentResponseIterator {
-	prompt := genai.Text(str_prompt)
-	return model.GenerateContentStream(ctx, prompt)
+func (p *Provider) Validate() error {
+	if p.apiKey == "" && p.credential == nil {
+		return errors.New("no Gemini API key set")
+	}
+	return nil
+}
+
+// authenticate fetches the API key or bearer token from the credential command and reconnects if it changed.
+// If refresh is set the cached one is dropped first, because the server rejected it.
+func (p *Provider) authenticate(ctx context.Context, refresh bool) error {
+	if p.credential == nil {
+		return nil
+	}
+	if refresh {
+		p.credential.Invalidate()
+	}
+
+	token, err := p.credential.Token(ctx)
+	if err != nil {
+		return err
+	}
+	if token.Token == p.apiKey {
+		return nil
+	}
+
+	// Bearer tokens go in the Authorization header, API keys in x-goog-api-key
+	auth := option.WithAPIKey(token.Token)
+	if token.Bearer() {
+		auth = option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token.Token, TokenType: "Bearer"}))
+	}
+
+	if p.client != nil {
+		p.client.Close()
+	}
+	p.apiKey = token.Token
+	return p.connect(auth)
+}
+
+// isRejectedCredential reports whether the server rejected the API key or token. Gemini answers 400 with the
+// reason API_KEY_INVALID for a bad or expired API key and 401 for an expired bearer token.
+func isRejectedCredential(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	return gerr.Code == http.StatusUnauthorized ||
+		gerr.Code == http.StatusBadRequest && strings.Contains(gerr.Body+gerr.Message, "API_KEY_INVALID")
+}
+
+// Models returns the Gemini models that can generate content
+func (p *Provider) Models(ctx context.Context) ([]llms.Model, error) {
+	if err := p.authenticate(ctx, false); err != nil {
+		return nil, err
+	}
+
+	var models []llms.Model
+	iter := p.client.ListModels(ctx)
+	for {
+		info, err := iter.Next()
+		if err == iterator.Done {
+			return models, nil
+		}
+		if err != nil {
+			return nil, describeError(err)
+		}
+
+		for _, method := range info.SupportedGenerationMethods {
+			if method == "generateContent" {
+				models = append(models, llms.Model{Name: strings.TrimPrefix(info.Name, "models/")})
+				break
+			}
+		}
+	}
+}
+
+func (p *Provider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	if err := p.authenticate(ctx, false); err != nil {
+		return nil, err
+	}
+
+	iter := p.sendMessage(ctx, req)
+
+	outputChan := make(chan llms.Chunk)
+
+	go func() {
+		defer close(outputChan)
+		received, refreshed := false, false
+		for {
+			resp, err := iter.Next()
+			if err == iterator.Done {
+				return // End of stream
+			}
+			if err != nil {
+				// The server may revoke a key before its stated expiry, in that case a fresh one is fetched once
+				if p.credential != nil && !received && !refreshed && isRejectedCredential(err) {
+					refreshed = true
+					if err = p.authenticate(ctx, true); err == nil {
+						iter = p.sendMessage(ctx, req)
+						continue
+					}
+				}
+
+				llms.Send(ctx, outputChan, llms.Chunk{Err: describeError(err)})
+				return
+			}
+			received = true
+
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				continue
+			}
+
+			for _, part := range resp.Candidates[0].Content.Parts {
+				chunk := llms.Chunk{Text: fmt.Sprintf("%v", part)}
+
+				// Commands suggested through the command tool arrive as function calls instead of text
+				if call, ok := part.(genai.FunctionCall); ok {
+					if call.Name != llms.CommandToolName {
+						continue
+					}
+					chunk.Text = ""
+					chunk.Commands, err = parseFunctionCall(call)
+					if err != nil {
+						llms.Send(ctx, outputChan, llms.Chunk{Err: err})
+						return
+					}
+				}
+
+				if !llms.Send(ctx, outputChan, chunk) {
+					return
+				}
+			}
+		}
+	}()
+
+	return outputChan, nil
+}
+
+// sendMessage starts streaming the response to the request
+func (p *Provider) sendMessage(ctx context.Context, req llms.Request) *genai.GenerateContentResponseIterator {
+	// Replay the earlier turns through a chat session so the model can tell its own answers apart from the user's
+	p.model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(req.CommandToolSystem())}}
+	p.model.Tools = nil
+	if req.CommandTool {
+		p.model.Tools = []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{commandTool}}}
+	}
+
+	chat := p.model.StartChat()
+	for _, message := range req.History {
+		role := "user"
+		if message.Role == llms.RoleAssistant {
+			role = "model"
+		}
+		chat.History = append(chat.History, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(message.Content)}})
+	}
+
+	return chat.SendMessageStream(ctx, genai.Text(req.Prompt))
+}
+
+// commandTool declares the command tool in the schema format Gemini expects
+var commandTool = &genai.FunctionDeclaration{
+	Name:        llms.CommandToolName,
+	Description: llms.CommandToolDescription,
+	Parameters: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"commands": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"command":       {Type: genai.TypeString, Description: "The bash command to run"},
+						"explanation":   {Type: genai.TypeString, Description: "A short explanation of what the command does"},
+						"requires_root": {Type: genai.TypeBoolean, Description: "Whether the command has to run as root"},
+						"risk": {
+							Type:        genai.TypeString,
+							Format:      "enum",
+							Enum:        []string{commands.RiskLow, commands.RiskMedium, commands.RiskHigh},
+							Description: "How much damage the command can do if it is wrong",
+						},
+					},
+					Required: []string{"command", "explanation", "requires_root", "risk"},
+				},
+			},
+		},
+		Required: []string{"commands"},
+	},
+}
+
+// parseFunctionCall decodes the arguments of a call to the command tool
+func parseFunctionCall(call genai.FunctionCall) ([]commands.Command, error) {
+	args, err := json.Marshal(call.Args)
+	if err != nil {
+		return nil, err
+	}
+	return llms.ParseCommandToolArgs(args)
+}
+
+// describeError adds a human readable explanation to the errors Gemini commonly returns
+func describeError(err error) error {
+	// Check if the error is due to safety filter activation
+	var berr *genai.BlockedError
+	if errors.As(err, &berr) || strings.Contains(err.Error(), "FinishReasonSafety") {
+		return fmt.Errorf("the content generation was blocked for safety reasons, please try a different prompt: %w", err)
+	}
+
+	// Report API errors like the HTTP based providers do, so rate limits and server errors are retried
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		message := gerr.Message
+		if message == "" {
+			message = llms.ErrorMessage([]byte(gerr.Body))
+		}
+		return &llms.StatusError{
+			StatusCode: gerr.Code,
+			Status:     fmt.Sprintf("%d %s", gerr.Code, http.StatusText(gerr.Code)),
+			Message:    message,
+		}
+	}
+
+	return err
 }
@@ -0,0 +1,59 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"google.golang.org/api/googleapi"
+)
+
+func TestDescribeErrorReportsStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+		retryable   bool
+	}{
+		{
+			"rate limited",
+			fmt.Errorf("googleapi: %w", &googleapi.Error{Code: http.StatusTooManyRequests, Message: "Resource has been exhausted"}),
+			http.StatusTooManyRequests, "Resource has been exhausted", true,
+		},
+		{
+			"unavailable with the message in the body",
+			&googleapi.Error{Code: http.StatusServiceUnavailable, Body: `{"error": {"code": 503, "message": "The model is overloaded"}}`},
+			http.StatusServiceUnavailable, "The model is overloaded", true,
+		},
+		{
+			"invalid key",
+			&googleapi.Error{Code: http.StatusBadRequest, Message: "API key not valid. Please pass a valid API key."},
+			http.StatusBadRequest, "API key not valid. Please pass a valid API key.", false,
+		},
+	}
+	for _, test := range tests {
+		err := describeError(test.err)
+
+		var statusErr *llms.StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("%s: describeError returned %v, want a status error", test.name, err)
+			continue
+		}
+		if statusErr.StatusCode != test.wantStatus || statusErr.Message != test.wantMessage {
+			t.Errorf("%s: status error is %d %q, want %d %q", test.name, statusErr.StatusCode, statusErr.Message, test.wantStatus, test.wantMessage)
+		}
+		if llms.IsRetryable(err) != test.retryable {
+			t.Errorf("%s: IsRetryable = %v, want %v", test.name, !test.retryable, test.retryable)
+		}
+	}
+}
+
+func TestDescribeErrorKeepsOtherErrors(t *testing.T) {
+	err := errors.New("connection closed")
+	if got := describeError(err); got != err {
+		t.Errorf("describeError = %v, want the error unchanged", got)
+	}
+}
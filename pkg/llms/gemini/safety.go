@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Categories the safety thresholds apply to, keyed by the name used in the configuration
+var safetyCategories = map[string]genai.HarmCategory{
+	"harassment": genai.HarmCategoryHarassment,
+	"hate":       genai.HarmCategoryHateSpeech,
+	"sexual":     genai.HarmCategorySexuallyExplicit,
+	"dangerous":  genai.HarmCategoryDangerousContent,
+}
+
+// Order the categories are sent in
+var safetyCategoryOrder = []string{"harassment", "hate", "sexual", "dangerous"}
+
+// Thresholds keyed by the name used in the configuration, from least to most strict
+var safetyThresholds = map[string]genai.HarmBlockThreshold{
+	"none":   genai.HarmBlockNone,
+	"high":   genai.HarmBlockOnlyHigh,
+	"medium": genai.HarmBlockMediumAndAbove,
+	"low":    genai.HarmBlockLowAndAbove,
+}
+
+// parseSafety turns a safety setting such as "medium" or "none,dangerous=high" into the settings for every category.
+// A threshold without a category applies to all categories, categories not mentioned block nothing.
+func parseSafety(setting string) ([]*genai.SafetySetting, error) {
+	thresholds := make(map[string]genai.HarmBlockThreshold)
+	for _, category := range safetyCategoryOrder {
+		thresholds[category] = genai.HarmBlockNone
+	}
+
+	for _, part := range strings.Split(setting, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+
+		category, thresholdName, hasCategory := strings.Cut(part, "=")
+		if !hasCategory {
+			thresholdName = category
+		}
+
+		threshold, ok := safetyThresholds[thresholdName]
+		if !ok {
+			return nil, errors.New("invalid safety threshold '" + thresholdName + "', please use 'none', 'high', 'medium' or 'low'")
+		}
+
+		if !hasCategory {
+			for _, category := range safetyCategoryOrder {
+				thresholds[category] = threshold
+			}
+			continue
+		}
+
+		if _, ok := safetyCategories[category]; !ok {
+			return nil, errors.New("invalid safety category '" + category + "', please use 'harassment', 'hate', 'sexual' or 'dangerous'")
+		}
+		thresholds[category] = threshold
+	}
+
+	settings := make([]*genai.SafetySetting, 0, len(safetyCategoryOrder))
+	for _, category := range safetyCategoryOrder {
+		settings = append(settings, &genai.SafetySetting{
+			Category:  safetyCategories[category],
+			Threshold: thresholds[category],
+		})
+	}
+	return settings, nil
+}
@@ -0,0 +1,88 @@
+package llms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned when an HTTP based provider answers with a non 2xx status code
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Message    string        // Error message sent by the server, if any
+	RetryAfter time.Duration // Wait the server asked for through the Retry-After header, if any
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return "server returned " + e.Status
+	}
+	return "server returned " + e.Status + ": " + e.Message
+}
+
+// CheckResponse returns a *StatusError if resp does not have a 2xx status code.
+// The body is read to find the error message the server sent, it is left untouched for successful responses.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Message:    ErrorMessage(body),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or a date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// ErrorMessage extracts the human readable message from an API error body.
+// It understands {"error": "..."}, {"error": {"message": "..."}} and {"message": "..."}, anything else is returned as is.
+func ErrorMessage(body []byte) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	switch e := data["error"].(type) {
+	case string:
+		return e
+	case map[string]interface{}:
+		if message, ok := e["message"].(string); ok {
+			return message
+		}
+		return fmt.Sprintf("%v", e)
+	}
+
+	if message, ok := data["message"].(string); ok {
+		return message
+	}
+
+	return strings.TrimSpace(string(body))
+}
+
+// IsUnauthorized reports whether the server rejected the credentials of a request
+func IsUnauthorized(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized
+}
@@ -0,0 +1,171 @@
+package llamacpp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+const DefaultHost = "http://127.0.0.1:8080"
+
+// How often the server is asked whether it finished loading the model
+const loadingPollInterval = 500 * time.Millisecond
+
+func init() {
+	llms.Register("llamacpp", func() llms.Provider { return &Provider{} })
+}
+
+// Provider generates responses through the /completion endpoint of a llama.cpp server
+type Provider struct {
+	host     string
+	template template
+	stop     []string
+	client   *http.Client
+}
+
+// completionRequest is the body sent to /completion
+type completionRequest struct {
+	Prompt      string   `json:"prompt"`
+	Stream      bool     `json:"stream"`
+	Stop        []string `json:"stop"`
+	NPredict    int      `json:"n_predict"`
+	CachePrompt bool     `json:"cache_prompt"`
+}
+
+// completionChunk is the payload of a single streamed event
+type completionChunk struct {
+	Content string `json:"content"`
+	Stop    bool   `json:"stop"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *Provider) Setup(opts llms.Options) error {
+	p.host = strings.TrimRight(opts.BaseURL, "/")
+	if p.host == "" {
+		p.host = DefaultHost
+	}
+
+	name := opts.Template
+	if name == "" {
+		name = DefaultTemplate
+	}
+	var ok bool
+	p.template, ok = templates[name]
+	if !ok {
+		return errors.New("unknown prompt template '" + name + "', available templates are: " + strings.Join(templateNames(), ", "))
+	}
+
+	p.stop = append(append([]string{}, p.template.stop...), opts.Stop...)
+	var err error
+	p.client, err = llms.NewHTTPClient(opts)
+	return err
+}
+
+func (p *Provider) Validate() error {
+	// The server answers 503 while it is still loading the model, that is fine as Stream waits for it
+	resp, err := p.client.Get(p.host + "/health")
+	if err != nil {
+		return fmt.Errorf("could not reach the llama.cpp server at %s, make sure llama-server is running: %w", p.host, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *Provider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	if err := p.waitUntilLoaded(ctx); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(completionRequest{
+		Prompt:      p.template.render(req),
+		Stream:      true,
+		Stop:        p.stop,
+		NPredict:    -1,
+		CachePrompt: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.host+"/completion", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the llama.cpp server at %s: %w", p.host, err)
+	}
+
+	if err := llms.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	outputChan := make(chan llms.Chunk)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(outputChan)
+
+		err := llms.ReadSSE(resp.Body, func(event llms.Event) error {
+			var chunk completionChunk
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				return fmt.Errorf("failed to decode stream event: %w", err)
+			}
+			if chunk.Error != nil {
+				return errors.New("llama.cpp: " + chunk.Error.Message)
+			}
+			if chunk.Content != "" && !llms.Send(ctx, outputChan, llms.Chunk{Text: chunk.Content}) {
+				return ctx.Err()
+			}
+			if chunk.Stop {
+				return llms.ErrEndOfStream
+			}
+			return nil
+		})
+
+		if err != nil && ctx.Err() == nil {
+			llms.Send(ctx, outputChan, llms.Chunk{Err: err})
+		}
+	}()
+
+	return outputChan, nil
+}
+
+// waitUntilLoaded polls /health until the server finished loading the model
+func (p *Provider) waitUntilLoaded(ctx context.Context) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", p.host+"/health", nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("could not reach the llama.cpp server at %s: %w", p.host, err)
+		}
+		err = llms.CheckResponse(resp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			return err
+		}
+
+		select {
+		case <-time.After(loadingPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package llamacpp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+// DefaultTemplate is used when no template is configured
+const DefaultTemplate = "chatml"
+
+// template turns a conversation into the raw prompt format a model was trained on.
+// The turn formats contain a single %s for the content of the turn.
+type template struct {
+	system     string   // Format of the system turn, empty if the model has none and the system prompt is put in front of the first user turn
+	user       string   // Format of a user turn
+	assistant  string   // Format of an earlier assistant turn
+	generation string   // Start of the assistant turn the model completes
+	stop       []string // Sequences that end the assistant turn
+}
+
+// The beginning of sequence token is left out, llama-server adds it when tokenizing the prompt
+var templates = map[string]template{
+	"chatml": {
+		system:     "<|im_start|>system\n%s<|im_end|>\n",
+		user:       "<|im_start|>user\n%s<|im_end|>\n",
+		assistant:  "<|im_start|>assistant\n%s<|im_end|>\n",
+		generation: "<|im_start|>assistant\n",
+		stop:       []string{"<|im_end|>", "<|im_start|>"},
+	},
+	"llama3": {
+		system:     "<|start_header_id|>system<|end_header_id|>\n\n%s<|eot_id|>",
+		user:       "<|start_header_id|>user<|end_header_id|>\n\n%s<|eot_id|>",
+		assistant:  "<|start_header_id|>assistant<|end_header_id|>\n\n%s<|eot_id|>",
+		generation: "<|start_header_id|>assistant<|end_header_id|>\n\n",
+		stop:       []string{"<|eot_id|>", "<|start_header_id|>"},
+	},
+	"mistral": {
+		user:      "[INST] %s [/INST]",
+		assistant: " %s</s>",
+		stop:      []string{"</s>", "[INST]"},
+	},
+	"gemma": {
+		user:       "<start_of_turn>user\n%s<end_of_turn>\n",
+		assistant:  "<start_of_turn>model\n%s<end_of_turn>\n",
+		generation: "<start_of_turn>model\n",
+		stop:       []string{"<end_of_turn>", "<start_of_turn>"},
+	},
+}
+
+// templateNames returns the names of all templates in alphabetical order
+func templateNames() []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// render builds the raw prompt for a request
+func (t template) render(req llms.Request) string {
+	var prompt strings.Builder
+
+	messages := req.Messages()
+	if t.system != "" {
+		prompt.WriteString(strings.Replace(t.system, "%s", req.System, 1))
+	} else if req.System != "" {
+		messages[0].Content = req.System + "\n\n" + messages[0].Content
+	}
+
+	for _, message := range messages {
+		format := t.user
+		if message.Role == llms.RoleAssistant {
+			format = t.assistant
+		}
+		prompt.WriteString(strings.Replace(format, "%s", message.Content, 1))
+	}
+	prompt.WriteString(t.generation)
+
+	return prompt.String()
+}
@@ -0,0 +1,163 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+)
+
+// Roles of the turns in a conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a single turn of a conversation
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request holds everything a provider needs to generate a response
+type Request struct {
+	System  string    // The pre-prompt describing lexido and the user's environment
+	History []Message // Earlier turns of the conversation when continuing one, oldest first
+	Prompt  string    // The user's prompt, including any piped input
+
+	// CommandTool asks providers that support tool calling to return commands through the suggest_commands tool
+	// instead of the @run syntax. Providers without tool support ignore it.
+	CommandTool bool
+}
+
+// Text joins the system prompt, the earlier turns and the user prompt for backends that only accept a single string
+func (r Request) Text() string {
+	var text strings.Builder
+	text.WriteString(r.System)
+	for _, message := range r.History {
+		if message.Role == RoleAssistant {
+			text.WriteString("\n Assistant: ")
+		} else {
+			text.WriteString("\n User: ")
+		}
+		text.WriteString(message.Content)
+	}
+	text.WriteString("\n User: ")
+	text.WriteString(r.Prompt)
+	return text.String()
+}
+
+// Messages returns the earlier turns followed by the user prompt
+func (r Request) Messages() []Message {
+	messages := make([]Message, 0, len(r.History)+1)
+	messages = append(messages, r.History...)
+	return append(messages, Message{Role: RoleUser, Content: r.Prompt})
+}
+
+// Chunk is a piece of a streamed response, a chunk with Err set is always the last one sent
+type Chunk struct {
+	Text     string
+	Commands []commands.Command // Commands the model suggested through the command tool
+	Err      error
+}
+
+// Options are the user supplied settings handed to a provider during Setup
+type Options struct {
+	Model   string // Model to use, providers fall back to their own default if empty
+	APIKey  string // API key for providers that need one
+	BaseURL string // Base URL of the API for providers that can talk to more than one server
+	Profile string // Named configuration profile for providers that support more than one
+	Fixture string // File the replay provider reads its chunks from
+
+	CredentialCommand string // Shell command printing a short-lived API key, used instead of APIKey by providers that support it
+
+	Template string   // Prompt template for providers that complete a raw prompt, such as chatml or llama3
+	Stop     []string // Extra sequences that end the response for providers that complete a raw prompt
+
+	Timeouts Timeouts // Only Connect is applied by the providers themselves, see WithTimeouts for the others
+	Network  Network  // Proxy and TLS settings for providers that talk to their server over HTTP
+
+	Generation GenerationConfig // Sampling parameters, unset values are left to the provider
+	Safety     string           // Safety thresholds for providers that support them, such as "medium" or "none,dangerous=high"
+}
+
+// GenerationConfig holds the sampling parameters of a request, nil means the provider's default is used
+type GenerationConfig struct {
+	Temperature     *float32
+	TopP            *float32
+	TopK            *int32
+	MaxOutputTokens *int32
+}
+
+// Provider is the interface every LLM backend implements
+type Provider interface {
+	// Setup configures the provider, it is called once before anything else
+	Setup(opts Options) error
+	// Validate checks that the provider is usable, for example that the model is installed
+	Validate() error
+	// Stream starts generating a response, the channel is closed once the response is complete
+	Stream(ctx context.Context, req Request) (<-chan Chunk, error)
+}
+
+// Model is a model offered by a provider
+type Model struct {
+	Name     string
+	Tag      string    // Variant of the model such as "8b" or "latest", for providers that have tags
+	Size     int64     // Size in bytes, 0 if unknown
+	Modified time.Time // When the model was installed or created, zero if unknown
+}
+
+// String returns the name the model is picked with, such as llama3:8b
+func (m Model) String() string {
+	if m.Tag == "" {
+		return m.Name
+	}
+	return m.Name + ":" + m.Tag
+}
+
+// ModelLister is implemented by providers that can list the models they offer
+type ModelLister interface {
+	Models(ctx context.Context) ([]Model, error)
+}
+
+var registry = make(map[string]func() Provider)
+
+// Register makes a provider available under the given name, it is meant to be called from init
+func Register(name string, factory func() Provider) {
+	if _, exists := registry[name]; exists {
+		panic("llms: provider " + name + " registered twice")
+	}
+	registry[name] = factory
+}
+
+// Get returns a new instance of the provider registered under name
+func Get(name string) (Provider, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, errors.New("unknown provider '" + name + "', available providers are: " + strings.Join(Names(), ", "))
+	}
+	return factory(), nil
+}
+
+// Names returns the names of all registered providers in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send delivers a chunk unless the context is cancelled first, it reports whether the chunk was sent
+func Send(ctx context.Context, out chan<- Chunk, chunk Chunk) bool {
+	select {
+	case out <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
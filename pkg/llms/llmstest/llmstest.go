@@ -0,0 +1,35 @@
+package llmstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+// Server starts a fake API server answering with handler, it is closed once the test is done
+func Server(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Collect reads a stream to its end and returns its text, the commands suggested through the command tool
+// and the first error in it
+func Collect(chunks <-chan llms.Chunk) (string, []commands.Command, error) {
+	var text strings.Builder
+	var cmds []commands.Command
+	var err error
+	for chunk := range chunks {
+		if chunk.Err != nil && err == nil {
+			err = chunk.Err
+		}
+		text.WriteString(chunk.Text)
+		cmds = append(cmds, chunk.Commands...)
+	}
+	return text.String(), cmds, err
+}
@@ -2,83 +2,280 @@ package ollama
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 
-	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/llms"
 )
 
-var llmModel string
+const defaultHost = "http://127.0.0.1:11434"
 
-var EOFThreshold = 50
+func init() {
+	llms.Register("ollama", func() llms.Provider { return &Provider{} })
+}
+
+// Provider generates responses through the HTTP API of an ollama server
+type Provider struct {
+	host     string
+	llmModel string
+	client   *http.Client
+}
+
+// chatRequest is the body sent to /api/chat
+type chatRequest struct {
+	Model    string              `json:"model"`
+	Messages []llms.Message      `json:"messages"`
+	Stream   bool                `json:"stream"`
+	Tools    []llms.FunctionTool `json:"tools,omitempty"`
+}
+
+// chatFrame is a single NDJSON frame streamed back by /api/chat
+type chatFrame struct {
+	Message struct {
+		Content   string `json:"content"`
+		ToolCalls []struct {
+			Function struct {
+				Name      string          `json:"name"`
+				Arguments json.RawMessage `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+}
+
+// tagsResponse is the body returned by /api/tags
+type tagsResponse struct {
+	Models []struct {
+		Name       string    `json:"name"`
+		Size       int64     `json:"size"`
+		ModifiedAt time.Time `json:"modified_at"`
+	} `json:"models"`
+}
+
+// Host returns the base URL of the ollama server, honouring OLLAMA_HOST the same way the ollama CLI does
+func Host() string {
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		return defaultHost
+	}
+
+	// Without a scheme ollama's own port is the default, with one the scheme's port is
+	scheme, address, found := strings.Cut(host, "://")
+	defaultPort := "11434"
+	if !found {
+		scheme, address = "http", host
+	} else if scheme == "https" {
+		defaultPort = "443"
+	} else {
+		defaultPort = "80"
+	}
+	address = strings.TrimRight(address, "/")
+
+	// OLLAMA_HOST may only contain a host, in which case the default port is used
+	hostname := address
+	if i := strings.LastIndex(address, "]"); i != -1 {
+		hostname = address[i:]
+	}
+	if !strings.Contains(hostname, ":") {
+		address += ":" + defaultPort
+	}
+
+	// Servers listening on all interfaces are reached through localhost
+	address = strings.Replace(address, "0.0.0.0", "127.0.0.1", 1)
 
-func Init(model string) error {
-	llmList, err := io.RunCmd("ollama", "list")
+	return scheme + "://" + address
+}
+
+func (p *Provider) Setup(opts llms.Options) error {
+	if opts.Model == "" {
+		return errors.New("no ollama model specified")
+	}
+	p.llmModel = opts.Model
+	p.host = Host()
+	var err error
+	p.client, err = llms.NewHTTPClient(opts)
+	return err
+}
+
+func (p *Provider) Validate() error {
+	models, err := p.Models(context.Background())
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return errors.New("ollama not installed on system, please install it first using the guide on https://github.com/micr0-dev/lexido?tab=readme-ov-file#running-locally")
-		}
 		return err
 	}
 
-	//  Check if model is in llm list
-	if !strings.Contains(llmList, model) {
-		return errors.New("Model not installed in ollama, please install it first using 'ollama run " + model + "'")
+	// Check if the exact model is installed, a model without a tag is the latest one just like in ollama itself
+	name, tag := splitName(p.llmModel)
+	var versions []string
+	for _, m := range models {
+		if !strings.EqualFold(m.Name, name) {
+			continue
+		}
+		if strings.EqualFold(m.Tag, tag) {
+			return nil
+		}
+		versions = append(versions, m.String())
 	}
 
-	llmModel = model
-
-	return nil
+	if len(versions) > 0 {
+		return fmt.Errorf("%w, the installed versions of %s are %s. Pick one of them with -m or install this one using 'ollama pull %s'", ErrModelNotInstalled, name, strings.Join(versions, ", "), p.llmModel)
+	}
+	return fmt.Errorf("%w, please install it first using 'ollama pull %s'", ErrModelNotInstalled, p.llmModel)
 }
 
-func GenerateContentStream(str_prompt string) (<-chan string, error) {
-	// Create a command. Replace "ollama", "run", llmModel with your actual command and arguments.
-	cmd := exec.Command("ollama", "run", llmModel, "\""+str_prompt+"\"")
+// Models returns the models installed on the ollama server
+func (p *Provider) Models(ctx context.Context) ([]llms.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.host+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get the command's standard output pipe.
-	stdout, err := cmd.StdoutPipe()
+	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return nil, fmt.Errorf("could not reach ollama at %s, make sure it is installed and running using the guide on https://github.com/micr0-dev/lexido?tab=readme-ov-file#running-locally: %w", p.host, err)
+	}
+	defer resp.Body.Close()
+
+	if err := llms.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var tags tagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
 	}
 
-	// Start the command.
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start command: %w", err)
+	models := make([]llms.Model, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		name, tag := splitName(m.Name)
+		models = append(models, llms.Model{Name: name, Tag: tag, Size: m.Size, Modified: m.ModifiedAt})
+	}
+	return models, nil
+}
+
+// splitName splits a model name such as llama3:8b into its name and tag, the tag is latest if there is none.
+// Names can contain a registry with a port such as localhost:5000/llama3, only a colon after the last slash starts the tag.
+func splitName(model string) (string, string) {
+	if i := strings.LastIndex(model, ":"); i > strings.LastIndex(model, "/") {
+		return model[:i], model[i+1:]
+	}
+	return model, "latest"
+}
+
+func (p *Provider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	resp, err := p.chat(ctx, req)
+
+	// Not every model supports tools, those fall back to the @run syntax
+	var statusErr *llms.StatusError
+	if req.CommandTool && errors.As(err, &statusErr) && strings.Contains(statusErr.Message, "does not support tools") {
+		req.CommandTool = false
+		resp, err = p.chat(ctx, req)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a channel to send the output.
-	outputChan := make(chan string)
+	outputChan := make(chan llms.Chunk)
 
-	// Go routine to read command's standard output.
+	// Go routine to read the NDJSON frames of the response.
 	go func() {
+		defer resp.Body.Close()
 		defer close(outputChan)
 
-		EOFCount := 0
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
 
-		// Use bufio.NewReader to read the output line by line.
-		reader := bufio.NewReader(stdout)
-		for {
-			line, err := reader.ReadString(' ')
-			if err != nil {
-				if strings.Contains(err.Error(), "EOF") {
-					EOFCount++
+			var frame chatFrame
+			if err := json.Unmarshal(line, &frame); err != nil {
+				llms.Send(ctx, outputChan, llms.Chunk{Err: fmt.Errorf("failed to decode ollama response: %w", err)})
+				return
+			}
+			if frame.Error != "" {
+				llms.Send(ctx, outputChan, llms.Chunk{Err: errors.New("ollama: " + frame.Error)})
+				return
+			}
+			for _, call := range frame.Message.ToolCalls {
+				if call.Function.Name != llms.CommandToolName {
+					continue
 				}
-
-				if EOFCount > EOFThreshold {
-					break
+				cmds, err := llms.ParseCommandToolArgs(call.Function.Arguments)
+				if err != nil {
+					llms.Send(ctx, outputChan, llms.Chunk{Err: err})
+					return
+				}
+				if !llms.Send(ctx, outputChan, llms.Chunk{Commands: cmds}) {
+					return
 				}
 			}
-			// Send the line to the channel.
-			outputChan <- line
+			if frame.Message.Content != "" {
+				if !llms.Send(ctx, outputChan, llms.Chunk{Text: frame.Message.Content}) {
+					return
+				}
+			}
+			if frame.Done {
+				return
+			}
 		}
 
-		// Wait for the command to finish.
-		if err := cmd.Wait(); err != nil {
-			fmt.Printf("command finished with error: %v\n", err)
+		if err := scanner.Err(); err != nil {
+			llms.Send(ctx, outputChan, llms.Chunk{Err: fmt.Errorf("error reading ollama stream: %w", err)})
+			return
 		}
+		llms.Send(ctx, outputChan, llms.Chunk{Err: errors.New("ollama stream ended before the response was done")})
 	}()
 
 	return outputChan, nil
 }
+
+// chat sends the request to /api/chat and returns the streaming response
+func (p *Provider) chat(ctx context.Context, req llms.Request) (*http.Response, error) {
+	messages := make([]llms.Message, 0, len(req.History)+2)
+	if system := req.CommandToolSystem(); system != "" {
+		messages = append(messages, llms.Message{Role: "system", Content: system})
+	}
+	messages = append(messages, req.Messages()...)
+
+	chatReq := chatRequest{
+		Model:    p.llmModel,
+		Messages: messages,
+		Stream:   true,
+	}
+	if req.CommandTool {
+		chatReq.Tools = []llms.FunctionTool{llms.CommandFunctionTool}
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach ollama at %s: %w", p.host, err)
+	}
+
+	if err := llms.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
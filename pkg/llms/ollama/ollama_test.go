@@ -0,0 +1,144 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"github.com/micr0-dev/lexido/pkg/llms/llmstest"
+)
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", "http://127.0.0.1:11434"},
+		{"example.com", "http://example.com:11434"},
+		{"example.com:1234", "http://example.com:1234"},
+		{"http://example.com", "http://example.com:80"},
+		{"https://example.com", "https://example.com:443"},
+		{"https://example.com:8443/", "https://example.com:8443"},
+		{"0.0.0.0", "http://127.0.0.1:11434"},
+		{"0.0.0.0:9000", "http://127.0.0.1:9000"},
+		{"[::1]", "http://[::1]:11434"},
+		{"[::1]:9000", "http://[::1]:9000"},
+		{"http://[fe80::1]", "http://[fe80::1]:80"},
+	}
+	for _, test := range tests {
+		t.Setenv("OLLAMA_HOST", test.env)
+		if got := Host(); got != test.want {
+			t.Errorf("Host() with OLLAMA_HOST=%q = %q, want %q", test.env, got, test.want)
+		}
+	}
+}
+
+// newTestProvider returns a provider for the model llama3 talking to a fake ollama server served by handler
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	t.Setenv("OLLAMA_HOST", llmstest.Server(t, handler).URL)
+
+	p := &Provider{}
+	if err := p.Setup(llms.Options{Model: "llama3"}); err != nil {
+		t.Fatalf("Setup returned %v", err)
+	}
+	return p
+}
+
+// chatHandler streams the frames as the response to /api/chat
+func chatHandler(t *testing.T, frames ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("request to %s, want /api/chat", r.URL.Path)
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode the request: %v", err)
+		}
+		if req.Model != "llama3" || !req.Stream {
+			t.Errorf("request for model %q with stream %v, want llama3 streamed", req.Model, req.Stream)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, frame := range frames {
+			fmt.Fprintln(w, frame)
+		}
+	}
+}
+
+func TestStreamStopsAtDone(t *testing.T) {
+	p := newTestProvider(t, chatHandler(t,
+		`{"message": {"content": "Hello"}, "done": false}`,
+		``,
+		`{"message": {"content": " world"}, "done": false}`,
+		`{"message": {"content": ""}, "done": true}`,
+		`{"message": {"content": " after done"}, "done": false}`,
+	))
+
+	chunks, err := p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if err != nil {
+		t.Errorf("stream failed with %v", err)
+	}
+	if text != "Hello world" {
+		t.Errorf("text = %q, want %q", text, "Hello world")
+	}
+}
+
+func TestStreamErrorFrame(t *testing.T) {
+	p := newTestProvider(t, chatHandler(t,
+		`{"message": {"content": "Hel"}, "done": false}`,
+		`{"error": "model runner has unexpectedly stopped"}`,
+	))
+
+	chunks, err := p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if text != "Hel" {
+		t.Errorf("text = %q, want %q", text, "Hel")
+	}
+	if err == nil || err.Error() != "ollama: model runner has unexpectedly stopped" {
+		t.Errorf("stream error = %v, want the error of the frame", err)
+	}
+}
+
+func TestStreamEndsWithoutDone(t *testing.T) {
+	p := newTestProvider(t, chatHandler(t,
+		`{"message": {"content": "Hello"}, "done": false}`,
+	))
+
+	chunks, err := p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if text != "Hello" {
+		t.Errorf("text = %q, want %q", text, "Hello")
+	}
+	if err == nil || !strings.Contains(err.Error(), "ended before the response was done") {
+		t.Errorf("stream error = %v, want a truncated stream to be reported", err)
+	}
+}
+
+func TestStreamHTTPError(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "model 'llama3' not found"}`)
+	})
+
+	_, err := p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	var statusErr *llms.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Stream returned %v, want a 404 status error", err)
+	}
+}
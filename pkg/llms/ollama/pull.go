@@ -0,0 +1,113 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+// ErrModelNotInstalled is returned by Validate if the model is not installed on the ollama server
+var ErrModelNotInstalled = errors.New("Model not installed in ollama")
+
+// PullProgress is a status update streamed by ollama while it pulls a model
+type PullProgress struct {
+	Model     string
+	Status    string // Such as "pulling manifest", "pulling 6a0746a1ec1a" or "success"
+	Completed int64  // Bytes of the current layer downloaded so far, if it is being downloaded
+	Total     int64  // Size of the current layer in bytes, if it is being downloaded
+}
+
+// pullFrame is a single NDJSON frame streamed back by /api/pull
+type pullFrame struct {
+	Status    string `json:"status"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
+	Error     string `json:"error"`
+}
+
+// Pull downloads the model onto the ollama server, notify is called with every status update
+func (p *Provider) Pull(ctx context.Context, notify func(PullProgress)) error {
+	body, err := json.Marshal(map[string]interface{}{"model": p.llmModel, "stream": true})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.host+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach ollama at %s: %w", p.host, err)
+	}
+	defer resp.Body.Close()
+
+	if err := llms.CheckResponse(resp); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", p.llmModel, err)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var frame pullFrame
+		if err := json.Unmarshal(line, &frame); err != nil {
+			return fmt.Errorf("failed to decode ollama pull status: %w", err)
+		}
+		if frame.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", p.llmModel, frame.Error)
+		}
+
+		if notify != nil {
+			notify(PullProgress{Model: p.llmModel, Status: frame.Status, Completed: frame.Completed, Total: frame.Total})
+		}
+		if frame.Status == "success" {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading ollama pull status: %w", err)
+	}
+	return fmt.Errorf("failed to pull %s: ollama stopped before the pull was done", p.llmModel)
+}
+
+// pullingProvider pulls the model the first time a response is requested
+type pullingProvider struct {
+	llms.Provider
+	model  *Provider
+	notify func(PullProgress)
+	pulled bool
+}
+
+// WithPull returns a provider that pulls the missing model of provider, reporting the progress to notify,
+// before next streams the first response. next is usually provider itself, possibly wrapped.
+func WithPull(provider *Provider, next llms.Provider, notify func(PullProgress)) llms.Provider {
+	return &pullingProvider{Provider: next, model: provider, notify: notify}
+}
+
+func (p *pullingProvider) Validate() error {
+	return nil
+}
+
+func (p *pullingProvider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	// Retries start over from here, the model only has to be pulled once
+	if !p.pulled {
+		if err := p.model.Pull(ctx, p.notify); err != nil {
+			return nil, err
+		}
+		p.pulled = true
+	}
+	return p.Provider.Stream(ctx, req)
+}
@@ -0,0 +1,134 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"github.com/micr0-dev/lexido/pkg/llms/llmstest"
+)
+
+// pullHandler streams the frames as the response to /api/pull
+func pullHandler(t *testing.T, frames ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pull" {
+			t.Errorf("request to %s, want /api/pull", r.URL.Path)
+		}
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode the request: %v", err)
+		}
+		if req.Model != "llama3" || !req.Stream {
+			t.Errorf("pull of model %q with stream %v, want llama3 streamed", req.Model, req.Stream)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, frame := range frames {
+			fmt.Fprintln(w, frame)
+		}
+	}
+}
+
+func TestPullProgress(t *testing.T) {
+	p := newTestProvider(t, pullHandler(t,
+		`{"status": "pulling manifest"}`,
+		`{"status": "pulling 6a0746a1ec1a", "digest": "sha256:6a0746a1ec1a", "total": 4661211424, "completed": 1048576}`,
+		``,
+		`{"status": "pulling 6a0746a1ec1a", "digest": "sha256:6a0746a1ec1a", "total": 4661211424, "completed": 4661211424}`,
+		`{"status": "verifying sha256 digest"}`,
+		`{"status": "success"}`,
+		`{"status": "after success"}`,
+	))
+
+	var progress []PullProgress
+	err := p.Pull(context.Background(), func(update PullProgress) {
+		progress = append(progress, update)
+	})
+	if err != nil {
+		t.Fatalf("Pull returned %v", err)
+	}
+
+	want := []PullProgress{
+		{Model: "llama3", Status: "pulling manifest"},
+		{Model: "llama3", Status: "pulling 6a0746a1ec1a", Completed: 1048576, Total: 4661211424},
+		{Model: "llama3", Status: "pulling 6a0746a1ec1a", Completed: 4661211424, Total: 4661211424},
+		{Model: "llama3", Status: "verifying sha256 digest"},
+		{Model: "llama3", Status: "success"},
+	}
+	if fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progress = %+v, want %+v", progress, want)
+	}
+}
+
+func TestPullErrorFrame(t *testing.T) {
+	p := newTestProvider(t, pullHandler(t,
+		`{"status": "pulling manifest"}`,
+		`{"error": "pull model manifest: file does not exist"}`,
+	))
+
+	err := p.Pull(context.Background(), nil)
+	if err == nil || err.Error() != "failed to pull llama3: pull model manifest: file does not exist" {
+		t.Errorf("Pull returned %v, want the error of the frame", err)
+	}
+}
+
+func TestPullEndsBeforeSuccess(t *testing.T) {
+	p := newTestProvider(t, pullHandler(t,
+		`{"status": "pulling manifest"}`,
+		`{"status": "pulling 6a0746a1ec1a", "total": 4661211424, "completed": 1048576}`,
+	))
+
+	err := p.Pull(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "stopped before the pull was done") {
+		t.Errorf("Pull returned %v, want a truncated pull to be reported", err)
+	}
+}
+
+func TestWithPullPullsOnceAcrossRetries(t *testing.T) {
+	var pulls, chats atomic.Int32
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/pull":
+			pulls.Add(1)
+			fmt.Fprintln(w, `{"status": "success"}`)
+		case "/api/chat":
+			// The model is still loading for the first two attempts
+			if chats.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, `{"message": {"content": "Hello"}, "done": true}`)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	})
+
+	var retries int
+	policy := llms.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	provider := llms.WithRetry(WithPull(p, p, nil), policy, func(llms.RetryEvent) { retries++ })
+
+	chunks, err := provider.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if err != nil || text != "Hello" {
+		t.Errorf("stream = %q, %v, want %q", text, err, "Hello")
+	}
+
+	if got := pulls.Load(); got != 1 {
+		t.Errorf("model was pulled %d times, want 1", got)
+	}
+	if got := chats.Load(); got != 3 || retries != 2 {
+		t.Errorf("chat was requested %d times with %d retries, want 3 with 2", got, retries)
+	}
+}
@@ -0,0 +1,229 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+const DefaultBaseURL = "https://api.openai.com/v1"
+const DefaultModel = "gpt-4o-mini"
+
+func init() {
+	llms.Register("openai", func() llms.Provider { return &Provider{} })
+}
+
+// Provider generates responses through an OpenAI compatible /chat/completions endpoint
+type Provider struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+// chatRequest is the body sent to /chat/completions
+type chatRequest struct {
+	Model    string              `json:"model"`
+	Messages []llms.Message      `json:"messages"`
+	Stream   bool                `json:"stream"`
+	Tools    []llms.FunctionTool `json:"tools,omitempty"`
+}
+
+// toolCallDelta is a fragment of a tool call, the arguments of a call are spread over many events
+type toolCallDelta struct {
+	Index    int `json:"index"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// chatChunk is the payload of a single streamed event
+type chatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string          `json:"content"`
+			ToolCalls []toolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *Provider) Setup(opts llms.Options) error {
+	p.baseURL = strings.TrimRight(opts.BaseURL, "/")
+	if p.baseURL == "" {
+		p.baseURL = DefaultBaseURL
+	}
+	p.model = opts.Model
+	if p.model == "" {
+		p.model = DefaultModel
+	}
+	p.apiKey = opts.APIKey
+	var err error
+	p.client, err = llms.NewHTTPClient(opts)
+	return err
+}
+
+func (p *Provider) Validate() error {
+	if !strings.HasPrefix(p.baseURL, "http://") && !strings.HasPrefix(p.baseURL, "https://") {
+		return errors.New("invalid base URL '" + p.baseURL + "', it has to start with http:// or https://")
+	}
+	return nil
+}
+
+// modelsResponse is the body returned by /models
+type modelsResponse struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	} `json:"data"`
+}
+
+// Models returns the models offered by the API
+func (p *Provider) Models(ctx context.Context) ([]llms.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := llms.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var list modelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+
+	models := make([]llms.Model, 0, len(list.Data))
+	for _, m := range list.Data {
+		model := llms.Model{Name: m.ID}
+		if m.Created != 0 {
+			model.Modified = time.Unix(m.Created, 0)
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// Messages builds the messages array for a request, the system prompt comes first followed by the conversation
+func Messages(req llms.Request) []llms.Message {
+	messages := make([]llms.Message, 0, len(req.History)+2)
+	if system := req.CommandToolSystem(); system != "" {
+		messages = append(messages, llms.Message{Role: "system", Content: system})
+	}
+	return append(messages, req.Messages()...)
+}
+
+func (p *Provider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	chatReq := chatRequest{
+		Model:    p.model,
+		Messages: Messages(req),
+		Stream:   true,
+	}
+	if req.CommandTool {
+		chatReq.Tools = []llms.FunctionTool{llms.CommandFunctionTool}
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := llms.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	outputChan := make(chan llms.Chunk)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(outputChan)
+
+		// Tool calls are streamed in fragments, they are collected by index and decoded once the stream is complete
+		var toolNames []string
+		var toolArgs []string
+
+		err := llms.ReadSSE(resp.Body, func(event llms.Event) error {
+			var chunk chatChunk
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				return fmt.Errorf("failed to decode stream event: %w", err)
+			}
+			if chunk.Error != nil {
+				return errors.New(chunk.Error.Message)
+			}
+			if len(chunk.Choices) == 0 {
+				return nil
+			}
+
+			delta := chunk.Choices[0].Delta
+			for _, call := range delta.ToolCalls {
+				for len(toolNames) <= call.Index {
+					toolNames = append(toolNames, "")
+					toolArgs = append(toolArgs, "")
+				}
+				toolNames[call.Index] += call.Function.Name
+				toolArgs[call.Index] += call.Function.Arguments
+			}
+
+			if delta.Content == "" {
+				return nil
+			}
+			if !llms.Send(ctx, outputChan, llms.Chunk{Text: delta.Content}) {
+				return ctx.Err()
+			}
+			return nil
+		})
+
+		for i, name := range toolNames {
+			if err != nil || name != llms.CommandToolName {
+				continue
+			}
+			var cmds llms.Chunk
+			cmds.Commands, err = llms.ParseCommandToolArgs([]byte(toolArgs[i]))
+			if err == nil && !llms.Send(ctx, outputChan, cmds) {
+				return
+			}
+		}
+
+		if err != nil && ctx.Err() == nil {
+			llms.Send(ctx, outputChan, llms.Chunk{Err: err})
+		}
+	}()
+
+	return outputChan, nil
+}
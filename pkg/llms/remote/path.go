@@ -0,0 +1,90 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is a single step of a field path, either an object key or an array index
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// isPath reports whether field_to_extract is a path such as choices[0].delta.content rather than a plain key name
+func isPath(field string) bool {
+	return strings.ContainsAny(field, ".[")
+}
+
+// parsePath splits a JSONPath-like expression such as $.choices[0].delta.content into its steps
+func parsePath(path string) ([]pathStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, errors.New("empty field path")
+	}
+
+	var steps []pathStep
+	for _, part := range strings.Split(path, ".") {
+		key, rest, hasIndex := strings.Cut(part, "[")
+		if key == "" && !hasIndex {
+			return nil, fmt.Errorf("invalid field path '%s': empty key", path)
+		}
+		if key != "" {
+			steps = append(steps, pathStep{key: key})
+		}
+
+		// Any number of indexes can follow a key, such as matrix[0][1]
+		for hasIndex {
+			indexStr, after, found := strings.Cut(rest, "]")
+			if !found {
+				return nil, fmt.Errorf("invalid field path '%s': missing ]", path)
+			}
+			index, err := strconv.Atoi(indexStr)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid field path '%s': '%s' is not a valid index", path, indexStr)
+			}
+			steps = append(steps, pathStep{index: index, isIndex: true})
+
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid field path '%s': unexpected '%s'", path, after)
+			}
+			rest, hasIndex = strings.CutPrefix(after, "[")
+		}
+	}
+
+	return steps, nil
+}
+
+// findPath follows the steps through the nested JSON structure, it returns an empty string if the path does not exist.
+func findPath(data interface{}, steps []pathStep) string {
+	for _, step := range steps {
+		if step.isIndex {
+			items, ok := data.([]interface{})
+			if !ok || step.index >= len(items) {
+				return ""
+			}
+			data = items[step.index]
+		} else {
+			object, ok := data.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			data = object[step.key]
+		}
+	}
+
+	switch v := data.(type) {
+	case nil:
+		// Streaming APIs often send null content in their last message
+		return ""
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		return fmt.Sprintf("Found, but not a string: %T", v)
+	}
+}
@@ -1,17 +1,21 @@
 package remote
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"mime"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"sort"
 	"strings"
 
+	"github.com/micr0-dev/lexido/pkg/credential"
 	lexio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/llms"
 )
 
 const defaultConfig = `{
@@ -25,39 +29,74 @@ const defaultConfig = `{
 		"model": "example-model",
 		"messages": "<PROMPT>"
 	  },
-	  "field_to_extract": "response" 
+	  "field_to_extract": "response",
+	  "stream_format": "ndjson"
 	}
   }`
 
 // Config represents the structure of the JSON configuration file
 type Config struct {
-	ApiConfig struct {
-		URL          string            `json:"url"`
-		Headers      map[string]string `json:"headers"`
-		DataTemplate interface{}       `json:"data_template"`
-		FieldOutput  string            `json:"field_to_extract"`
-	} `json:"api_config"`
+	ApiConfig      ApiConfig            `json:"api_config"`      // Single unnamed profile, kept for configs written before profiles existed
+	Profiles       map[string]ApiConfig `json:"profiles"`        // Named profiles such as "groq" or "internal-vllm"
+	DefaultProfile string               `json:"default_profile"` // Profile used when none is picked on the command line
 }
 
-// replacePrompt recursively searches for the <PROMPT> placeholder and replaces it
-func replacePrompt(data interface{}, prompt string) interface{} {
-	switch v := data.(type) {
-	case map[string]interface{}:
-		for key, value := range v {
-			v[key] = replacePrompt(value, prompt)
-		}
-	case []interface{}:
-		for i, item := range v {
-			v[i] = replacePrompt(item, prompt)
+// ApiConfig describes how to talk to a single API endpoint
+type ApiConfig struct {
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	DataTemplate interface{}       `json:"data_template"`
+	FieldOutput  string            `json:"field_to_extract"`
+	StreamFormat string            `json:"stream_format"`
+	Model        string            `json:"model"` // Model filled in for <MODEL> when none is given with -m
+
+	CredentialCommand string `json:"credential_command"` // Command printing the token referenced as ${credential}
+
+	llms.Network // proxy, ca_file, client_cert, client_key and insecure_skip_verify
+}
+
+// Profile returns the API configuration of the named profile, or of the default profile if name is empty
+func (c Config) Profile(name string) (ApiConfig, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+
+	if name == "" {
+		if c.ApiConfig.URL != "" || len(c.Profiles) == 0 {
+			return c.ApiConfig, nil
 		}
-	case string:
-		if v == "<PROMPT>" {
-			return prompt
+		if len(c.Profiles) == 1 {
+			for _, profile := range c.Profiles {
+				return profile, nil
+			}
 		}
+		return ApiConfig{}, errors.New("no default_profile set in the remote configuration file, please set one or pick a profile with -p. Available profiles are: " + strings.Join(c.ProfileNames(), ", "))
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return ApiConfig{}, errors.New("remote profile '" + name + "' not found, available profiles are: " + strings.Join(c.ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the names of all profiles in alphabetical order
+func (c Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
 	}
-	return data
+	sort.Strings(names)
+	return names
 }
 
+// Values for stream_format, if it is not set the format is picked from the content type of the response
+const (
+	StreamFormatNDJSON     = "ndjson"
+	StreamFormatSSE        = "sse"
+	StreamFormatSingleJSON = "single-json"
+)
+
 // LoadConfig loads the configuration from the file and returns it
 func LoadConfig() (Config, error) {
 	filepath, err := lexio.GetFilePath("remoteConfig.json")
@@ -69,7 +108,7 @@ func LoadConfig() (Config, error) {
 	configFile, err := os.ReadFile(filepath)
 	if err != nil {
 		// Create a default configuration file if it doesn't exist
-		err := os.WriteFile(filepath, []byte(defaultConfig), 0644)
+		err := os.WriteFile(filepath, []byte(defaultConfig), 0600)
 		if err != nil {
 			return Config{}, err
 		}
@@ -84,12 +123,22 @@ func LoadConfig() (Config, error) {
 	return config, nil
 }
 
-// ExtractOutput initiates the extraction process by unmarshaling the JSON response and calling findField recursively.
+// ExtractOutput unmarshals the JSON response and extracts the field from it.
+// The field can be a path such as choices[0].delta.content, or a plain key name which is searched for recursively.
 func ExtractOutput(response []byte, field string) (string, error) {
-	var output map[string]interface{}
+	var output interface{}
 	if err := json.Unmarshal(response, &output); err != nil {
 		return "", err
 	}
+
+	if isPath(field) {
+		steps, err := parsePath(field)
+		if err != nil {
+			return "", err
+		}
+		return findPath(output, steps), nil
+	}
+
 	return findField(output, field), nil
 }
 
@@ -106,9 +155,14 @@ func findField(data interface{}, field string) string {
 			// If it's not a string but a nested structure, you might want to handle it differently or return an indication of its type.
 			return fmt.Sprintf("Found, but not a string: %T", value)
 		}
-		// Otherwise, search recursively in each value.
-		for _, value := range v {
-			if found := findField(value, field); found != "" {
+		// Otherwise, search recursively in each value, in key order so the result does not depend on map iteration order.
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if found := findField(v[key], field); found != "" {
 				return found
 			}
 		}
@@ -124,64 +178,256 @@ func findField(data interface{}, field string) string {
 	return ""
 }
 
-// Generate sends a POST request to the API endpoint with the prompt and returns a channel of responses
-func GenerateContentStream(prompt string) (<-chan string, error) {
+func init() {
+	llms.Register("remote", func() llms.Provider { return &Provider{} })
+}
+
+// Provider generates responses through the REST API described in remoteConfig.json
+type Provider struct {
+	config     ApiConfig
+	model      string
+	client     *http.Client
+	credential *credential.Helper // Set if the profile has a credential_command
+}
+
+func (p *Provider) Setup(opts llms.Options) error {
 	config, err := LoadConfig()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	p.config, err = config.Profile(opts.Profile)
+	if err != nil {
+		return err
 	}
 
-	// Replace <PROMPT> in the DataTemplate
-	config.ApiConfig.DataTemplate = replacePrompt(config.ApiConfig.DataTemplate, prompt)
+	p.model = opts.Model
+	if p.model == "" {
+		p.model = p.config.Model
+	}
+	if p.config.CredentialCommand != "" {
+		p.credential = credential.New(p.config.CredentialCommand)
+	}
 
-	// Marshal the data template back into JSON for the API request
-	jsonData, err := json.Marshal(config.ApiConfig.DataTemplate)
+	opts.Network = p.config.Network
+	p.client, err = llms.NewHTTPClient(opts)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("invalid network settings in the remote configuration file: %w", err)
 	}
+	return nil
+}
 
-	// Create and send the API request
-	req, err := http.NewRequest("POST", config.ApiConfig.URL, strings.NewReader(string(jsonData)))
-	if err != nil {
-		log.Fatal(err)
+func (p *Provider) Validate() error {
+	if p.config.URL == "" {
+		return errors.New("no url set in the remote configuration file")
 	}
-	for key, value := range config.ApiConfig.Headers {
-		req.Header.Add(key, value)
+
+	if isPath(p.config.FieldOutput) {
+		if _, err := parsePath(p.config.FieldOutput); err != nil {
+			return fmt.Errorf("invalid field_to_extract in the remote configuration file: %w", err)
+		}
+	}
+
+	switch p.config.StreamFormat {
+	case "", StreamFormatNDJSON, StreamFormatSSE, StreamFormatSingleJSON:
+	default:
+		return errors.New("invalid stream_format '" + p.config.StreamFormat + "' in the remote configuration file, please use 'ndjson', 'sse' or 'single-json'")
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return nil
+}
+
+// Stream sends a POST request to the API endpoint with the prompt and returns a channel of responses
+func (p *Provider) Stream(ctx context.Context, prompt llms.Request) (<-chan llms.Chunk, error) {
+	resp, err := p.send(ctx, prompt)
+
+	// The server may revoke a token before its stated expiry, in that case a fresh one is fetched once
+	if p.credential != nil && llms.IsUnauthorized(err) {
+		p.credential.Invalidate()
+		resp, err = p.send(ctx, prompt)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// Create a channel to send responses
-	responseChan := make(chan string)
+	responseChan := make(chan llms.Chunk)
 
 	// Handle the response in a separate goroutine
 	go func() {
 		defer resp.Body.Close()
 		defer close(responseChan)
-		reader := bufio.NewReader(resp.Body)
 
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err == io.EOF {
-				break // End of stream
-			}
-			if err != nil {
-				log.Printf("Error reading stream: %v", err)
-				break
-			}
+		send := func(extracted string) bool {
+			return llms.Send(ctx, responseChan, llms.Chunk{Text: extracted})
+		}
 
-			extracted, err := ExtractOutput(line, config.ApiConfig.FieldOutput)
-			if err != nil {
-				log.Printf("Error extracting output: %v", err)
-				continue
-			}
-			responseChan <- extracted
+		var err error
+		switch streamFormat(p.config.StreamFormat, resp.Header.Get("Content-Type")) {
+		case StreamFormatSSE:
+			err = p.readSSE(resp.Body, send)
+		case StreamFormatSingleJSON:
+			err = p.readSingleJSON(resp.Body, send)
+		default:
+			err = p.readNDJSON(resp.Body, send)
+		}
+		if err != nil && ctx.Err() == nil {
+			llms.Send(ctx, responseChan, llms.Chunk{Err: err})
 		}
 	}()
 
 	return responseChan, nil
 }
+
+// send sends the request for the prompt to the API endpoint and returns the response if it was successful
+func (p *Provider) send(ctx context.Context, prompt llms.Request) (*http.Response, error) {
+	var token string
+	if p.credential != nil {
+		credential, err := p.credential.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		token = credential.Token
+	}
+
+	// Resolve the secrets before the prompt is inserted, so the prompt itself is never interpolated
+	dataTemplate, err := resolveTemplateSecrets(p.config.DataTemplate, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace <PROMPT>, <SYSTEM>, <USER>, <MESSAGES> and <MODEL> in the DataTemplate
+	dataTemplate = replacePlaceholders(dataTemplate, newPlaceholders(prompt, p.model))
+
+	// Marshal the data template back into JSON for the API request
+	jsonData, err := json.Marshal(dataTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := resolveSecrets(p.config.URL, token)
+	if err != nil {
+		return nil, err
+	}
+	url = strings.ReplaceAll(url, placeholderModel, neturl.PathEscape(p.model))
+
+	// Create and send the API request
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range p.config.Headers {
+		value, err := resolveSecrets(value, token)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add(key, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := llms.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// streamFormat picks how to read a response. Without a stream_format in the configuration an event stream is
+// recognised by its content type, everything else is read as a sequence of JSON documents.
+func streamFormat(configured string, contentType string) string {
+	if configured != "" {
+		return configured
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "text/event-stream" {
+		return StreamFormatSSE
+	}
+	return StreamFormatNDJSON
+}
+
+// readNDJSON reads a stream of JSON documents. They are usually one per line, but documents spanning several lines
+// such as the pretty printed body of a non-streaming API are read just as well.
+func (p *Provider) readNDJSON(body io.Reader, send func(string) bool) error {
+	decoder := json.NewDecoder(body)
+
+	for {
+		var document json.RawMessage
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return nil // End of stream
+		}
+		if err != nil {
+			return fmt.Errorf("error reading stream: %w", err)
+		}
+
+		extracted, err := p.extract(document)
+		if err != nil {
+			return err
+		}
+		if !send(extracted) {
+			return nil
+		}
+	}
+}
+
+// extract returns the configured field of a JSON document, or the error if the document is an API error object
+func (p *Provider) extract(document []byte) (string, error) {
+	extracted, err := ExtractOutput(document, p.config.FieldOutput)
+	if err != nil {
+		return "", fmt.Errorf("error extracting output: %w", err)
+	}
+	if extracted == "" {
+		if err := apiError(document); err != nil {
+			return "", err
+		}
+	}
+	return extracted, nil
+}
+
+// apiError returns the error described by a JSON document of the form {"error": ...}, if it is one
+func apiError(document []byte) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(document, &data); err != nil {
+		return nil
+	}
+	switch e := data["error"].(type) {
+	case nil:
+		return nil
+	case string:
+		if e == "" {
+			return nil
+		}
+	}
+	return errors.New("server returned an error: " + llms.ErrorMessage(document))
+}
+
+// readSSE reads a Server-Sent Events stream where every data: field holds a JSON object
+func (p *Provider) readSSE(body io.Reader, send func(string) bool) error {
+	return llms.ReadSSE(body, func(event llms.Event) error {
+		extracted, err := p.extract([]byte(event.Data))
+		if err != nil {
+			return err
+		}
+		if !send(extracted) {
+			return llms.ErrEndOfStream
+		}
+		return nil
+	})
+}
+
+// readSingleJSON reads a response consisting of a single JSON document
+func (p *Provider) readSingleJSON(body io.Reader, send func(string) bool) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	extracted, err := p.extract(data)
+	if err != nil {
+		return err
+	}
+	send(extracted)
+	return nil
+}
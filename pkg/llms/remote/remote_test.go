@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"github.com/micr0-dev/lexido/pkg/llms/llmstest"
+)
+
+// newCredentialProvider returns a provider for a profile that authenticates with a token from a credential command.
+// The command prints tok-1 on its first run, tok-2 on its second and so on, each valid for an hour.
+func newCredentialProvider(t *testing.T, url string) *Provider {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	counter := filepath.Join(home, "runs")
+	config := Config{Profiles: map[string]ApiConfig{"internal": {
+		URL:               url,
+		Headers:           map[string]string{"Authorization": "Bearer ${credential}"},
+		DataTemplate:      map[string]interface{}{"prompt": "<PROMPT>"},
+		FieldOutput:       "response",
+		StreamFormat:      StreamFormatNDJSON,
+		CredentialCommand: `n=$(( $(cat ` + counter + ` 2>/dev/null || echo 0) + 1 )); echo $n > ` + counter + `; printf '{"token": "tok-%s", "expires_in": 3600}' $n`,
+	}}}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".lexido"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".lexido", "remoteConfig.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{}
+	if err := p.Setup(llms.Options{Profile: "internal"}); err != nil {
+		t.Fatalf("Setup returned %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate returned %v", err)
+	}
+	return p
+}
+
+func TestStreamRefreshesRejectedCredential(t *testing.T) {
+	var tokens []string
+	server := llmstest.Server(t, func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		// The server revoked the first token although it has not expired yet
+		if r.Header.Get("Authorization") != "Bearer tok-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"message": "token revoked"}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"response": "hello"}`)
+	})
+	p := newCredentialProvider(t, server.URL)
+
+	chunks, err := p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if err != nil || text != "hello" {
+		t.Errorf("stream = %q, %v, want %q", text, err, "hello")
+	}
+	if fmt.Sprint(tokens) != fmt.Sprint([]string{"Bearer tok-1", "Bearer tok-2"}) {
+		t.Errorf("server got the tokens %q, want tok-1 and then the fresh tok-2", tokens)
+	}
+
+	// The fresh token is cached for the next request
+	chunks, err = p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	llmstest.Collect(chunks)
+	if len(tokens) != 3 || tokens[2] != "Bearer tok-2" {
+		t.Errorf("server got the tokens %q, want the cached tok-2 to be reused", tokens)
+	}
+}
+
+func TestStreamRefreshesCredentialOnlyOnce(t *testing.T) {
+	var requests int
+	server := llmstest.Server(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": {"message": "not allowed"}}`)
+	})
+	p := newCredentialProvider(t, server.URL)
+
+	_, err := p.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if !llms.IsUnauthorized(err) {
+		t.Errorf("Stream returned %v, want the 401 of the server", err)
+	}
+	if requests != 2 {
+		t.Errorf("server got %d requests, want 2", requests)
+	}
+}
@@ -0,0 +1,97 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	lexio "github.com/micr0-dev/lexido/pkg/io"
+)
+
+// credentialName is the reference to the token printed by the credential_command of the profile, ${credential}
+const credentialName = "credential"
+
+// keyringPrefix marks a value that is read from the lexido keyring as a whole, such as "keyring:GROQ_KEY"
+const keyringPrefix = "keyring:"
+
+// Regular expression to find ${NAME} and ${keyring:NAME} references inside a string
+var secretRegex = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// resolveSecrets replaces the ${ENV_VAR}, ${keyring:NAME} and ${credential} references in value, a value of the form keyring:NAME
+// is replaced entirely. credential is the token printed by the credential_command, empty if the profile has none.
+func resolveSecrets(value string, credential string) (string, error) {
+	if strings.HasPrefix(value, keyringPrefix) {
+		return readKeyring(strings.TrimPrefix(value, keyringPrefix))
+	}
+
+	var resolveErr error
+	resolved := secretRegex.ReplaceAllStringFunc(value, func(match string) string {
+		name := secretRegex.FindStringSubmatch(match)[1]
+
+		var secret string
+		var err error
+		if name == credentialName {
+			secret, err = credential, nil
+			if credential == "" {
+				err = errors.New("${credential} is referenced in the remote configuration file but no credential_command is set")
+			}
+		} else if strings.HasPrefix(name, keyringPrefix) {
+			secret, err = readKeyring(strings.TrimPrefix(name, keyringPrefix))
+		} else {
+			secret, err = readEnv(name)
+		}
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return secret
+	})
+
+	return resolved, resolveErr
+}
+
+// resolveTemplateSecrets returns a copy of data with the secret references in every string resolved
+func resolveTemplateSecrets(data interface{}, credential string) (interface{}, error) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			r, err := resolveTemplateSecrets(value, credential)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = r
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := resolveTemplateSecrets(item, credential)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	case string:
+		return resolveSecrets(v, credential)
+	}
+	return data, nil
+}
+
+func readEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s referenced in the remote configuration file is not set", name)
+	}
+	return value, nil
+}
+
+func readKeyring(name string) (string, error) {
+	value, err := lexio.ReadFromKeyring(name)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s referenced in the remote configuration file from the keyring: %w", name, err)
+	}
+	return value, nil
+}
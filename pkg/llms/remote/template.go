@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+// Placeholders that are replaced in the data_template
+const (
+	placeholderPrompt   = "<PROMPT>"   // System prompt, earlier turns and user prompt joined into a single string
+	placeholderSystem   = "<SYSTEM>"   // System prompt
+	placeholderUser     = "<USER>"     // User prompt, including any piped input
+	placeholderMessages = "<MESSAGES>" // Earlier turns and the user prompt as an array of role/content objects
+	placeholderModel    = "<MODEL>"    // Model picked with -m or set in the profile
+)
+
+// placeholders holds the values the placeholders of a request are replaced with
+type placeholders struct {
+	replacer *strings.Replacer // Substitutes the placeholders inside larger strings
+	messages []interface{}
+}
+
+func newPlaceholders(req llms.Request, model string) placeholders {
+	messages := make([]interface{}, 0, len(req.History)+1)
+	for _, message := range req.Messages() {
+		messages = append(messages, map[string]interface{}{"role": message.Role, "content": message.Content})
+	}
+
+	// Inside a larger string the messages can only be substituted as JSON text
+	encoded, _ := json.Marshal(messages)
+
+	// A single pass, so placeholders that are part of the prompt itself are left alone
+	replacer := strings.NewReplacer(
+		placeholderPrompt, req.Text(),
+		placeholderSystem, req.System,
+		placeholderUser, req.Prompt,
+		placeholderMessages, string(encoded),
+		placeholderModel, model,
+	)
+
+	return placeholders{replacer: replacer, messages: messages}
+}
+
+// replacePlaceholders replaces the placeholders in a copy of data.
+// A string that is exactly <MESSAGES> becomes the array of messages, inside an array the messages are spliced in
+// so that a system message can be put in front of them. Placeholders inside larger strings are substituted as text.
+func replacePlaceholders(data interface{}, values placeholders) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		replaced := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			replaced[key] = replacePlaceholders(value, values)
+		}
+		return replaced
+	case []interface{}:
+		replaced := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item == placeholderMessages {
+				replaced = append(replaced, values.messages...)
+				continue
+			}
+			replaced = append(replaced, replacePlaceholders(item, values))
+		}
+		return replaced
+	case string:
+		return values.replaceString(v)
+	}
+	return data
+}
+
+// replaceString substitutes the placeholders in a string, <MESSAGES> is only kept as an array when it is the whole value
+func (values placeholders) replaceString(s string) interface{} {
+	if s == placeholderMessages {
+		return values.messages
+	}
+	return values.replacer.Replace(s)
+}
@@ -0,0 +1,92 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+// recorder writes the chunks of the provider it wraps to a fixture file while passing them on
+type recorder struct {
+	llms.Provider
+	path string
+}
+
+// Record wraps a provider so that every response it streams is saved to a fixture file the replay provider can read.
+// The file is overwritten by each request.
+func Record(provider llms.Provider, path string) llms.Provider {
+	return &recorder{Provider: provider, path: path}
+}
+
+func (r *recorder) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the recording: %w", err)
+	}
+
+	last := time.Now()
+	chunks, err := r.Provider.Stream(ctx, req)
+	if err != nil {
+		// Record the failure too, it is often what the bug report is about
+		writeErr := writeFrame(file, errorFrame(err, 0))
+		file.Close()
+		return nil, errors.Join(err, writeErr)
+	}
+
+	outputChan := make(chan llms.Chunk)
+
+	go func() {
+		defer close(outputChan)
+		defer file.Close()
+
+		var recordErr error
+		for chunk := range chunks {
+			now := time.Now()
+			delay := int(now.Sub(last).Milliseconds())
+			last = now
+
+			frame := Frame{Delay: delay, Text: chunk.Text, Commands: chunk.Commands}
+			if chunk.Err != nil {
+				frame = errorFrame(chunk.Err, delay)
+			}
+			if recordErr == nil {
+				recordErr = writeFrame(file, frame)
+			}
+
+			if !llms.Send(ctx, outputChan, chunk) {
+				return
+			}
+		}
+
+		if recordErr != nil {
+			llms.Send(ctx, outputChan, llms.Chunk{Err: fmt.Errorf("could not write the recording: %w", recordErr)})
+		}
+	}()
+
+	return outputChan, nil
+}
+
+// errorFrame records an error along with its status code if it came from an HTTP API
+func errorFrame(err error, delay int) Frame {
+	frame := Frame{Delay: delay, Error: err.Error()}
+	var serr *llms.StatusError
+	if errors.As(err, &serr) {
+		frame.Error = serr.Message
+		frame.Status = serr.StatusCode
+	}
+	return frame
+}
+
+func writeFrame(file *os.File, frame Frame) error {
+	line, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
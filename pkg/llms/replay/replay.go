@@ -0,0 +1,115 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/llms"
+)
+
+func init() {
+	llms.Register("replay", func() llms.Provider { return &Provider{} })
+}
+
+// Frame is a single chunk of a fixture file, fixtures hold one JSON encoded frame per line
+type Frame struct {
+	Delay    int                `json:"delay_ms,omitempty"` // Milliseconds to wait before sending the chunk
+	Text     string             `json:"text,omitempty"`
+	Commands []commands.Command `json:"commands,omitempty"`
+	Error    string             `json:"error,omitempty"`  // Ends the stream with this error
+	Status   int                `json:"status,omitempty"` // HTTP status code of the error, so it is reported like the error seen live
+}
+
+// Provider streams the chunks of a fixture file instead of asking a model
+type Provider struct {
+	path   string
+	frames []Frame
+}
+
+func (p *Provider) Setup(opts llms.Options) error {
+	p.path = opts.Fixture
+	if p.path == "" {
+		return nil
+	}
+
+	var err error
+	p.frames, err = ReadFixture(p.path)
+	return err
+}
+
+func (p *Provider) Validate() error {
+	if p.path == "" {
+		return errors.New("no fixture file set")
+	}
+	return nil
+}
+
+func (p *Provider) Stream(ctx context.Context, req llms.Request) (<-chan llms.Chunk, error) {
+	outputChan := make(chan llms.Chunk)
+
+	go func() {
+		defer close(outputChan)
+		for _, frame := range p.frames {
+			if frame.Delay > 0 {
+				select {
+				case <-time.After(time.Duration(frame.Delay) * time.Millisecond):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			chunk := llms.Chunk{Text: frame.Text, Commands: frame.Commands}
+			if frame.Error != "" || frame.Status != 0 {
+				chunk = llms.Chunk{Err: frame.err()}
+			}
+			if !llms.Send(ctx, outputChan, chunk) || chunk.Err != nil {
+				return
+			}
+		}
+	}()
+
+	return outputChan, nil
+}
+
+// err turns the error of a frame back into the error the provider returned
+func (f Frame) err() error {
+	if f.Status == 0 {
+		return errors.New(f.Error)
+	}
+	return &llms.StatusError{
+		StatusCode: f.Status,
+		Status:     fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		Message:    f.Error,
+	}
+}
+
+// ReadFixture reads the frames of a fixture file, blank lines are skipped
+func ReadFixture(path string) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var frames []Frame
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("invalid frame on line %d of %s: %w", line, path, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, scanner.Err()
+}
@@ -0,0 +1,157 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how often and how long to wait before retrying a failed request
+type RetryPolicy struct {
+	Attempts  int           // Total number of attempts including the first one, 1 disables retrying
+	BaseDelay time.Duration // Wait before the first retry, doubled for every following retry
+	MaxDelay  time.Duration // Upper bound of the wait between two attempts
+}
+
+// DefaultRetryPolicy is used when the user did not configure anything else
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  4,
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+}
+
+// RetryEvent is reported every time a failed request is about to be retried
+type RetryEvent struct {
+	Attempt  int           // The attempt that is about to be made, starting at 2
+	Attempts int           // Total number of attempts that will be made
+	Wait     time.Duration // Time until the next attempt
+	Err      error         // The error that caused the retry
+}
+
+// IsRetryable reports whether err is a rate limit, a server error or a dropped connection that is worth retrying
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Backoff returns the wait before the given retry, exponential with jitter and never shorter than a Retry-After the server sent.
+// It reports false if the server asked to wait longer than MaxDelay, in which case retrying is not worth it.
+func (policy RetryPolicy) Backoff(retry int, err error) (time.Duration, bool) {
+	wait := policy.BaseDelay << (retry - 1)
+	if wait > policy.MaxDelay || wait <= 0 {
+		wait = policy.MaxDelay
+	}
+
+	// Wait between half and all of the delay so that clients hitting the same limit spread out
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > wait {
+		if statusErr.RetryAfter > policy.MaxDelay {
+			return 0, false
+		}
+		wait = statusErr.RetryAfter
+	}
+	return wait, true
+}
+
+// retryProvider retries failed requests of the wrapped provider
+type retryProvider struct {
+	Provider
+	policy RetryPolicy
+	notify func(RetryEvent)
+}
+
+// WithRetry wraps a provider so that retryable errors are retried according to the policy.
+// Only errors that happen before the first chunk arrives are retried, as retrying later would repeat text that was already shown.
+// notify is called before waiting for every retry, it may be nil.
+func WithRetry(provider Provider, policy RetryPolicy, notify func(RetryEvent)) Provider {
+	return &retryProvider{Provider: provider, policy: policy, notify: notify}
+}
+
+func (r *retryProvider) Stream(ctx context.Context, req Request) (<-chan Chunk, error) {
+	for attempt := 1; ; attempt++ {
+		chunks, first, err := start(ctx, r.Provider, req)
+		if err == nil {
+			return forward(ctx, first, chunks), nil
+		}
+
+		if attempt >= r.policy.Attempts || !IsRetryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait, ok := r.policy.Backoff(attempt, err)
+		if !ok {
+			return nil, err
+		}
+		if r.notify != nil {
+			r.notify(RetryEvent{Attempt: attempt + 1, Attempts: r.policy.Attempts, Wait: wait, Err: err})
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// forward returns a channel that yields first, if set, followed by everything sent on chunks
+func forward(ctx context.Context, first *Chunk, chunks <-chan Chunk) <-chan Chunk {
+	if first == nil {
+		return chunks
+	}
+
+	out := make(chan Chunk)
+	go func() {
+		defer close(out)
+		if !Send(ctx, out, *first) {
+			return
+		}
+		for chunk := range chunks {
+			if !Send(ctx, out, chunk) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// start starts a stream and waits for its first chunk, an error in the first chunk is returned as the error of the stream
+func start(ctx context.Context, provider Provider, req Request) (<-chan Chunk, *Chunk, error) {
+	chunks, err := provider.Stream(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	select {
+	case chunk, ok := <-chunks:
+		if !ok {
+			return chunks, nil, nil
+		}
+		if chunk.Err != nil {
+			return nil, nil, chunk.Err
+		}
+		return chunks, &chunk, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
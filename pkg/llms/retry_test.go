@@ -0,0 +1,171 @@
+package llms_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/llms"
+	"github.com/micr0-dev/lexido/pkg/llms/llmstest"
+	"github.com/micr0-dev/lexido/pkg/llms/openai"
+)
+
+// newOpenAI returns an OpenAI provider talking to the fake server, through its own HTTP client
+func newOpenAI(t *testing.T, server *httptest.Server) llms.Provider {
+	t.Helper()
+	p := &openai.Provider{}
+	if err := p.Setup(llms.Options{BaseURL: server.URL + "/v1", APIKey: "test-key", Model: "gpt-test"}); err != nil {
+		t.Fatalf("Setup returned %v", err)
+	}
+	return p
+}
+
+func TestRetryRecoversFromRateLimitAndServerError(t *testing.T) {
+	var requests atomic.Int32
+	server := llmstest.Server(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("request to %s with authorization %q, want the chat completions with the API key", r.URL.Path, r.Header.Get("Authorization"))
+		}
+
+		switch requests.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error": {"message": "Rate limit reached for gpt-test", "type": "requests"}}`)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error": {"message": "The server is overloaded"}}`)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data: {"choices": [{"delta": {"role": "assistant", "content": "hello"}}]}`+"\n\n")
+			fmt.Fprint(w, `data: {"choices": [{"delta": {"content": " world"}}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}
+	})
+
+	var events []llms.RetryEvent
+	policy := llms.RetryPolicy{Attempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Second}
+	provider := llms.WithRetry(newOpenAI(t, server), policy, func(event llms.RetryEvent) {
+		events = append(events, event)
+	})
+
+	chunks, err := provider.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if err != nil {
+		t.Fatalf("stream failed with %v", err)
+	}
+	if text != "hello world" {
+		t.Errorf("text = %q, want %q", text, "hello world")
+	}
+
+	if got := requests.Load(); got != 3 {
+		t.Errorf("server got %d requests, want 3", got)
+	}
+	if len(events) != 2 {
+		t.Fatalf("notify was called %d times, want 2", len(events))
+	}
+
+	var statusErr *llms.StatusError
+	if !errors.As(events[0].Err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("first retry error = %v, want a 429 status error", events[0].Err)
+	} else if statusErr.RetryAfter != time.Second || !strings.Contains(statusErr.Message, "Rate limit reached") {
+		t.Errorf("first retry error has Retry-After %v and message %q, want those of the response", statusErr.RetryAfter, statusErr.Message)
+	}
+	if events[0].Attempt != 2 || events[0].Attempts != 4 {
+		t.Errorf("first retry is attempt %d of %d, want 2 of 4", events[0].Attempt, events[0].Attempts)
+	}
+	if events[0].Wait < time.Second {
+		t.Errorf("first retry waits %v, want at least the Retry-After of 1s", events[0].Wait)
+	}
+	if !errors.As(events[1].Err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second retry error = %v, want a 503 status error", events[1].Err)
+	}
+}
+
+func TestRetryDoesNotRetryAfterFirstChunk(t *testing.T) {
+	var requests atomic.Int32
+	server := llmstest.Server(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices": [{"delta": {"content": "partial"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"error": {"message": "stream broke"}}`+"\n\n")
+	})
+
+	notified := false
+	policy := llms.RetryPolicy{Attempts: 4, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	provider := llms.WithRetry(newOpenAI(t, server), policy, func(llms.RetryEvent) { notified = true })
+
+	chunks, err := provider.Stream(context.Background(), llms.Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Stream returned %v", err)
+	}
+	text, _, err := llmstest.Collect(chunks)
+	if text != "partial" {
+		t.Errorf("text = %q, want %q", text, "partial")
+	}
+	if err == nil || err.Error() != "stream broke" {
+		t.Errorf("stream error = %v, want the error of the stream", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+	if notified {
+		t.Error("notify was called although nothing was retried")
+	}
+}
+
+func TestBackoffGivesUpOnLongRetryAfter(t *testing.T) {
+	policy := llms.RetryPolicy{Attempts: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	if _, ok := policy.Backoff(1, &llms.StatusError{StatusCode: 429, RetryAfter: time.Minute}); ok {
+		t.Error("Backoff retries although Retry-After is above MaxDelay")
+	}
+
+	wait, ok := policy.Backoff(1, &llms.StatusError{StatusCode: 429, RetryAfter: 10 * time.Second})
+	if !ok || wait != 10*time.Second {
+		t.Errorf("Backoff = %v, %v, want the Retry-After of 10s", wait, ok)
+	}
+
+	wait, ok = policy.Backoff(10, errors.New("boom"))
+	if !ok || wait < policy.MaxDelay/2 || wait > policy.MaxDelay {
+		t.Errorf("Backoff = %v, %v, want a wait capped at MaxDelay", wait, ok)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection reset", reset, true},
+		{"wrapped connection reset", fmt.Errorf("request failed: %w", reset), true},
+		{"canceled", context.Canceled, false},
+		{"wrapped canceled", fmt.Errorf("request failed: %w", context.Canceled), false},
+		{"rate limited", &llms.StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &llms.StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"bad request", &llms.StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &llms.StatusError{StatusCode: http.StatusUnauthorized}, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, test := range tests {
+		if got := llms.IsRetryable(test.err); got != test.want {
+			t.Errorf("IsRetryable(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
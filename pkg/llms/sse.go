@@ -0,0 +1,83 @@
+package llms
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Event is a single Server-Sent Event
+type Event struct {
+	Name string // Value of the event: field, empty if the server did not send one
+	Data string // Value of the data: fields, joined by newlines
+}
+
+// ErrEndOfStream can be returned by an event handler to stop reading without reporting an error
+var ErrEndOfStream = errors.New("end of stream")
+
+// ReadSSE reads Server-Sent Events from r and calls handle for each of them until the stream ends or handle returns an error.
+// Comments and keep-alive lines are skipped. The [DONE] sentinel used by OpenAI compatible APIs ends the stream.
+func ReadSSE(r io.Reader, handle func(Event) error) error {
+	err := readSSE(r, handle)
+	if errors.Is(err, ErrEndOfStream) {
+		return nil
+	}
+	return err
+}
+
+func readSSE(r io.Reader, handle func(Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var event Event
+	var data []string
+
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = Event{}
+			return nil
+		}
+		event.Data = strings.Join(data, "\n")
+		err := handle(event)
+		event, data = Event{}, nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		// A blank line ends the current event
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Lines starting with a colon are comments, usually used as keep-alives
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Name = value
+		case "data":
+			if value == "[DONE]" {
+				return nil
+			}
+			data = append(data, value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Dispatch anything left if the server did not end with a blank line
+	return dispatch()
+}
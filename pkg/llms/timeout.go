@@ -0,0 +1,99 @@
+package llms
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts limit how long lexido waits on a provider, a zero value disables a timeout
+type Timeouts struct {
+	Connect    time.Duration // Establishing the connection to the server
+	FirstToken time.Duration // From sending the request until the first chunk arrives, which includes loading the model
+	Idle       time.Duration // Between two chunks of a response
+}
+
+// TimeoutError is returned when a provider did not answer in time
+type TimeoutError struct {
+	FirstToken bool          // Whether the provider never answered, rather than stopping in the middle of the response
+	After      time.Duration // The timeout that fired
+}
+
+func (e *TimeoutError) Error() string {
+	if e.FirstToken {
+		return "no response within " + e.After.String()
+	}
+	return "the response stalled, nothing was received for " + e.After.String()
+}
+
+// timeoutProvider cancels the responses of the provider it wraps when they take too long
+type timeoutProvider struct {
+	Provider
+	timeouts Timeouts
+}
+
+// WithTimeouts wraps a provider so that a response fails with a *TimeoutError if its first chunk or the gap
+// between two chunks takes longer than the given timeouts
+func WithTimeouts(provider Provider, timeouts Timeouts) Provider {
+	if timeouts.FirstToken <= 0 && timeouts.Idle <= 0 {
+		return provider
+	}
+	return &timeoutProvider{Provider: provider, timeouts: timeouts}
+}
+
+func (t *timeoutProvider) Stream(ctx context.Context, req Request) (<-chan Chunk, error) {
+	streamCtx, cancel := context.WithCancelCause(ctx)
+
+	// Most providers only return from Stream once the server answered, so the first token timer starts right away
+	var timer *time.Timer
+	startTimer := func(d time.Duration, err error) {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = nil
+		if d > 0 {
+			timer = time.AfterFunc(d, func() { cancel(err) })
+		}
+	}
+	startTimer(t.timeouts.FirstToken, &TimeoutError{FirstToken: true, After: t.timeouts.FirstToken})
+
+	chunks, err := t.Provider.Stream(streamCtx, req)
+	if err != nil {
+		startTimer(0, nil)
+		if cause := context.Cause(streamCtx); cause != nil && ctx.Err() == nil {
+			err = cause
+		}
+		cancel(nil)
+		return nil, err
+	}
+
+	outputChan := make(chan Chunk)
+
+	go func() {
+		defer close(outputChan)
+		defer cancel(nil)
+		defer startTimer(0, nil)
+
+		for {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					return
+				}
+
+				// From now on the gaps between chunks are timed
+				startTimer(t.timeouts.Idle, &TimeoutError{After: t.timeouts.Idle})
+
+				if !Send(ctx, outputChan, chunk) {
+					return
+				}
+			case <-streamCtx.Done():
+				if ctx.Err() == nil {
+					Send(ctx, outputChan, Chunk{Err: context.Cause(streamCtx)})
+				}
+				return
+			}
+		}
+	}()
+
+	return outputChan, nil
+}
@@ -0,0 +1,103 @@
+package llms
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// Name and description of the tool models call to suggest commands
+const (
+	CommandToolName        = "suggest_commands"
+	CommandToolDescription = "Suggest shell commands for the user to run. Call this exactly once with all commands you suggest."
+)
+
+// CommandToolSchema is the JSON schema of the arguments of the command tool
+var CommandToolSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"commands": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{
+						"type":        "string",
+						"description": "The bash command to run",
+					},
+					"explanation": map[string]interface{}{
+						"type":        "string",
+						"description": "A short explanation of what the command does",
+					},
+					"requires_root": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Whether the command has to run as root",
+					},
+					"risk": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{commands.RiskLow, commands.RiskMedium, commands.RiskHigh},
+						"description": "How much damage the command can do if it is wrong",
+					},
+				},
+				"required": []string{"command", "explanation", "requires_root", "risk"},
+			},
+		},
+	},
+	"required": []string{"commands"},
+}
+
+// FunctionTool describes a function the model can call in the format of the OpenAI chat completions API,
+// which ollama accepts as well
+type FunctionTool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+// Function is the name, description and JSON schema of the arguments of a function tool
+type Function struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  interface{} `json:"parameters"`
+}
+
+// CommandFunctionTool is the command tool as a function tool
+var CommandFunctionTool = FunctionTool{
+	Type: "function",
+	Function: Function{
+		Name:        CommandToolName,
+		Description: CommandToolDescription,
+		Parameters:  CommandToolSchema,
+	},
+}
+
+// CommandToolSystem returns the system prompt for providers that offer the command tool
+func (r Request) CommandToolSystem() string {
+	if !r.CommandTool {
+		return r.System
+	}
+	return r.System + " " + prompt.CommandToolPrePrompt
+}
+
+// ParseCommandToolArgs decodes the arguments the model passed to the command tool
+func ParseCommandToolArgs(args []byte) ([]commands.Command, error) {
+	var call struct {
+		Commands []commands.Command `json:"commands"`
+	}
+	if err := json.Unmarshal(args, &call); err != nil {
+		return nil, errors.New("invalid " + CommandToolName + " arguments: " + err.Error())
+	}
+
+	parsed := make([]commands.Command, 0, len(call.Commands))
+	for _, command := range call.Commands {
+		command.Command = strings.TrimSpace(command.Command)
+		if command.Command == "" {
+			continue
+		}
+		command.Risk = strings.ToLower(command.Risk)
+		parsed = append(parsed, command)
+	}
+	return parsed, nil
+}
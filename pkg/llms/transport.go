@@ -0,0 +1,85 @@
+package llms
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Network configures how a provider reaches its server, such as through a corporate proxy with a private CA
+type Network struct {
+	Proxy              string `json:"proxy"`                // URL of the HTTP proxy, if empty HTTPS_PROXY, HTTP_PROXY and NO_PROXY are used
+	CAFile             string `json:"ca_file"`              // PEM file with certificate authorities to trust in addition to the system ones
+	ClientCert         string `json:"client_cert"`          // PEM file with the certificate presented to servers that require one
+	ClientKey          string `json:"client_key"`           // PEM file with the private key of the client certificate
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // Accept any server certificate, only meant for testing
+}
+
+// NewHTTPClient returns the HTTP client providers use to talk to their servers
+func NewHTTPClient(opts Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Timeouts.Connect > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: opts.Timeouts.Connect, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = opts.Timeouts.Connect
+	}
+
+	network := opts.Network
+	if network.Proxy != "" {
+		proxy, err := url.Parse(network.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, errors.New("invalid proxy '" + network.Proxy + "', it has to be a URL such as http://proxy.example.com:3128")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := network.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// tlsConfig builds the TLS configuration for the custom CA and client certificate, nil keeps the defaults
+func (n Network) tlsConfig() (*tls.Config, error) {
+	if n.CAFile == "" && n.ClientCert == "" && n.ClientKey == "" && !n.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: n.InsecureSkipVerify}
+
+	if n.CAFile != "" {
+		pem, err := os.ReadFile(n.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in the CA file " + n.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if n.ClientCert != "" || n.ClientKey != "" {
+		if n.ClientCert == "" || n.ClientKey == "" {
+			return nil, errors.New("a client certificate needs both client_cert and client_key")
+		}
+		cert, err := tls.LoadX509KeyPair(n.ClientCert, n.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,44 +16,113 @@ import (
 
 const maxWidth = 200
 
-type model struct {
-	spinner                spinner.Model
-	commands               *[]string
+// columnGap is the number of spaces between the responses in compare mode
+const columnGap = 4
+
+// pane holds the response of a single provider, compare mode shows one pane per provider side by side
+type pane struct {
+	name                   string // Provider that answers, only shown in compare mode
 	response               string
-	choices                []string
-	selected               []bool
-	cursor                 int
-	width                  int
-	height                 int
+	toolCommands           []commands.Command
 	displayedContentLength int
-	commandless            bool
-	isDone                 bool
-	hasSudo                bool
-	isLocal                bool
+	err                    error // Why the provider failed in compare mode, the other panes keep going
+}
+
+type model struct {
+	spinner     spinner.Model
+	commands    *[]string
+	panes       []pane
+	choices     []commands.Command
+	sources     [][]string // Providers that suggested each choice in compare mode
+	selected    []bool
+	cursor      int
+	width       int
+	height      int
+	commandless bool
+	isDone      bool
+	hasSudo     bool
+	hasHighRisk bool
+	isLocal     bool
+	status      string
+	answeredBy  string
+	err         error
 }
 
 type (
 	AppendResponseMsg string
 	GenerationDoneMsg struct{}
+	// CommandsMsg carries commands the model suggested through the command tool
+	CommandsMsg []commands.Command
+	// RetryMsg reports that a failed request is about to be retried
+	RetryMsg struct {
+		Attempt  int
+		Attempts int
+		Wait     time.Duration
+		Err      error
+	}
+	// FallbackMsg reports that a provider failed and the next one in the chain is tried
+	FallbackMsg struct {
+		Failed string
+		Err    error
+		Next   string
+	}
+	// AnsweredByMsg names the provider that is answering when more than one could have
+	AnsweredByMsg string
+	// ErrorMsg reports that generating the response failed, the TUI shows the error and exits
+	ErrorMsg struct {
+		Err error
+	}
+	// PaneResponseMsg appends text to the response of a provider in compare mode
+	PaneResponseMsg struct {
+		Pane int
+		Text string
+	}
+	// PaneCommandsMsg carries the commands a provider suggested through the command tool in compare mode
+	PaneCommandsMsg struct {
+		Pane     int
+		Commands []commands.Command
+	}
+	// PaneErrorMsg reports that a provider failed in compare mode
+	PaneErrorMsg struct {
+		Pane int
+		Err  error
+	}
+	// PullMsg reports the progress of pulling a missing ollama model
+	PullMsg struct {
+		Model     string
+		Status    string
+		Completed int64
+		Total     int64
+	}
 )
 
 func InitialModel(commmands *[]string, local bool) model {
+	return InitialCompareModel(commmands, []string{""}, local)
+}
+
+// InitialCompareModel creates a model that shows the responses of the named providers side by side
+func InitialCompareModel(commmands *[]string, names []string, local bool) model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
+
+	panes := make([]pane, len(names))
+	for i, name := range names {
+		panes[i].name = name
+	}
+
 	return model{
-		spinner:                s,
-		commands:               commmands,
-		response:               "",
-		choices:                make([]string, 0),
-		selected:               make([]bool, 0),
-		cursor:                 0,
-		width:                  0,
-		height:                 0,
-		displayedContentLength: 0,
-		commandless:            true,
-		isDone:                 false,
-		hasSudo:                false,
-		isLocal:                local,
+		spinner:     s,
+		commands:    commmands,
+		panes:       panes,
+		choices:     make([]commands.Command, 0),
+		selected:    make([]bool, 0),
+		cursor:      0,
+		width:       0,
+		height:      0,
+		commandless: true,
+		isDone:      false,
+		hasSudo:     false,
+		isLocal:     local,
 	}
 }
 
@@ -69,32 +139,61 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if m.displayedContentLength >= len(m.response) && len(m.response) > 0 && m.commandless && m.isDone {
+	if m.fullyDisplayed() && m.hasOutput() && m.commandless && m.isDone {
 		return m.Close(false)
 	}
 
 	switch msg := msg.(type) {
 	case AppendResponseMsg:
-		m.response += string(msg)
-		m.choices = commands.ParseCommands(m.response)
-		m.selected = make([]bool, len(m.choices)+1)
-		m.commandless = m.choices == nil || len(m.choices) == 0
-		m.hasSudo = commands.ContainsSudo(m.choices)
+		m.panes[0].response += string(msg)
+		m.updateChoices()
+	case CommandsMsg:
+		m.panes[0].toolCommands = append(m.panes[0].toolCommands, msg...)
+		m.updateChoices()
+	case PaneResponseMsg:
+		m.panes[msg.Pane].response += msg.Text
+		m.updateChoices()
+	case PaneCommandsMsg:
+		m.panes[msg.Pane].toolCommands = append(m.panes[msg.Pane].toolCommands, msg.Commands...)
+		m.updateChoices()
+	case PaneErrorMsg:
+		m.panes[msg.Pane].err = msg.Err
 	case GenerationDoneMsg:
 		m.isDone = true
+	case RetryMsg:
+		m.status = fmt.Sprintf("%v, retrying in %s (attempt %d/%d)...", msg.Err, msg.Wait.Round(100*time.Millisecond), msg.Attempt, msg.Attempts)
+	case FallbackMsg:
+		m.status = fmt.Sprintf("%s failed: %v, falling back to %s...", msg.Failed, msg.Err, msg.Next)
+	case AnsweredByMsg:
+		m.answeredBy = string(msg)
+	case PullMsg:
+		m.status = pullStatus(msg)
+	case ErrorMsg:
+		m.err = msg.Err
+		for i := range m.panes {
+			m.panes[i].displayedContentLength = len(m.panes[i].response)
+		}
+		return m.Close(false)
 	case tickMsg:
-		totalResponseLength := len(m.response)
-		// Logic to increment displayedContentLength
-		chunkSize := rand.Intn(7) + 2 // Random chunk size between 1 and 5
-		m.displayedContentLength += chunkSize
+		var totalResponseLength, totalDisplayedLength int
+		for i := range m.panes {
+			pane := &m.panes[i]
+
+			// Logic to increment displayedContentLength
+			chunkSize := rand.Intn(7) + 2 // Random chunk size between 1 and 5
+			pane.displayedContentLength += chunkSize
 
-		// Ensure we don't exceed the total content length
-		if m.displayedContentLength > totalResponseLength {
-			m.displayedContentLength = totalResponseLength
+			// Ensure we don't exceed the total content length
+			if pane.displayedContentLength > len(pane.response) {
+				pane.displayedContentLength = len(pane.response)
+			}
+
+			totalResponseLength += len(pane.response)
+			totalDisplayedLength += pane.displayedContentLength
 		}
 
 		// Adjust the timing based on the proportion of the content displayed
-		sleepMs := int(math.Max(float64(m.displayedContentLength)/float64(totalResponseLength)*30, 1))
+		sleepMs := int(math.Max(float64(totalDisplayedLength)/float64(totalResponseLength)*30, 1))
 		interval := time.Duration(sleepMs) * time.Millisecond
 
 		return m, tickCmd(interval)
@@ -136,12 +235,59 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// fullyDisplayed reports whether the typing animation caught up with every response
+func (m model) fullyDisplayed() bool {
+	for _, pane := range m.panes {
+		if pane.displayedContentLength < len(pane.response) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasOutput reports whether any provider answered or failed
+func (m model) hasOutput() bool {
+	for _, pane := range m.panes {
+		if pane.response != "" || pane.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// updateChoices rebuilds the command list from the tool commands and the commands found in the responses.
+// In compare mode a command suggested by more than one provider is listed once, tagged with all of them.
+func (m *model) updateChoices() {
+	m.choices = m.choices[:0]
+	m.sources = m.sources[:0]
+	index := make(map[string]int)
+	for _, pane := range m.panes {
+		paneCommands := append(append([]commands.Command{}, pane.toolCommands...), commands.FromStrings(commands.ParseCommands(pane.response))...)
+		for _, command := range paneCommands {
+			i, seen := index[command.Command]
+			if !seen {
+				i = len(m.choices)
+				index[command.Command] = i
+				m.choices = append(m.choices, command)
+				m.sources = append(m.sources, nil)
+			}
+			if pane.name != "" && !slices.Contains(m.sources[i], pane.name) {
+				m.sources[i] = append(m.sources[i], pane.name)
+			}
+		}
+	}
+	m.selected = make([]bool, len(m.choices)+1)
+	m.commandless = len(m.choices) == 0
+	m.hasSudo = commands.ContainsSudo(m.choices)
+	m.hasHighRisk = commands.ContainsHighRisk(m.choices)
+}
+
 func (m model) Close(exec bool) (tea.Model, tea.Cmd) {
 	// Collect the selected commands
 	if exec {
 		for i, selected := range m.selected {
 			if selected {
-				*m.commands = append(*m.commands, m.choices[i])
+				*m.commands = append(*m.commands, m.choices[i].Command)
 			}
 		}
 		fmt.Print("\n")
@@ -155,8 +301,18 @@ func (m model) View() string {
 
 	s.WriteString("\033[0m")
 
-	if m.response == "" {
-		if m.isLocal {
+	if m.err != nil {
+		if response := m.viewResponses(); response != "" {
+			s.WriteString(response + "\n\n")
+		}
+		s.WriteString(format.WrapText("\033[31m"+m.err.Error()+"\033[0m", min(m.width, maxWidth)) + "\n")
+		return s.String()
+	}
+
+	if !m.hasOutput() && m.commandless {
+		if m.status != "" {
+			s.WriteString(format.WrapText(fmt.Sprintf("%s%s", m.spinner.View(), m.status), min(m.width, maxWidth)))
+		} else if m.isLocal {
 			s.WriteString(fmt.Sprintf("%sInitializing...", m.spinner.View()))
 		} else {
 			s.WriteString(fmt.Sprintf("%sConnecting...", m.spinner.View()))
@@ -164,13 +320,11 @@ func (m model) View() string {
 		return s.String()
 	}
 
-	displayContent := format.TrimWhitespace(m.response)
-	if len(displayContent) > m.displayedContentLength {
-		displayContent = displayContent[:m.displayedContentLength]
-	}
+	s.WriteString(m.viewResponses())
 
-	wrappedResponse := format.WrapText(commands.HighlightCommands(displayContent), min(m.width, maxWidth))
-	s.WriteString(wrappedResponse)
+	if m.answeredBy != "" && m.fullyDisplayed() {
+		s.WriteString("\n\n\033[2mAnswered by " + m.answeredBy + "\033[0m")
+	}
 
 	if m.commandless {
 		return s.String()
@@ -189,12 +343,19 @@ func (m model) View() string {
 			selected = " "
 			color = "\033[0m"
 		}
+		label := riskLabel(todo.Risk)
+		if len(m.panes) > 1 {
+			label += " \033[2m[" + strings.Join(m.sources[i], ", ") + "]\033[0m"
+		}
 		if m.cursor == i {
-			s.WriteString(fmt.Sprintf("> "+color+"["+selected+"] %s\n", todo))
+			s.WriteString(fmt.Sprintf("> "+color+"["+selected+"] %s%s\n", todo.Command, label))
 		} else {
-			s.WriteString(fmt.Sprintf("  "+color+"["+selected+"] %s\n", todo))
+			s.WriteString(fmt.Sprintf("  "+color+"["+selected+"] %s%s\n", todo.Command, label))
 		}
 		s.WriteString("\033[0m")
+		if todo.Explanation != "" {
+			s.WriteString("\033[2m      " + todo.Explanation + "\033[0m\n")
+		}
 	}
 
 	if m.cursor == len(m.choices) {
@@ -207,7 +368,88 @@ func (m model) View() string {
 		s.WriteString(format.WrapText("\n\033[31mWarning: This response contains sudo commands. Please thoroughly review the commands before running them.\033[0m\n", min(m.width, maxWidth)))
 	}
 
+	if m.hasHighRisk {
+		s.WriteString(format.WrapText("\n\033[31mWarning: Some of these commands were marked as high risk. Please thoroughly review the commands before running them.\033[0m\n", min(m.width, maxWidth)))
+	}
+
 	s.WriteString(format.WrapText("\nPlease select the tasks to run. q to quit. up/down to select", min(m.width, maxWidth)))
 
 	return s.String()
 }
+
+// viewResponses renders the part of the responses that has been typed out so far, side by side in compare mode
+func (m model) viewResponses() string {
+	width := min(m.width, maxWidth)
+	if len(m.panes) == 1 {
+		return format.WrapText(m.viewPane(m.panes[0]), width)
+	}
+
+	columnWidth := max((width-columnGap*(len(m.panes)-1))/len(m.panes), 1)
+
+	columns := make([][]string, len(m.panes))
+	rows := 0
+	for i, pane := range m.panes {
+		columns[i] = format.WrapColumn("\033[1m"+pane.name+"\033[0m\n\n"+m.viewPane(pane), columnWidth)
+		rows = max(rows, len(columns[i]))
+	}
+
+	lines := make([]string, rows)
+	for row := range lines {
+		var line strings.Builder
+		for i, column := range columns {
+			var cell string
+			if row < len(column) {
+				cell = column[row]
+			}
+			line.WriteString(cell)
+			if i < len(columns)-1 {
+				line.WriteString(strings.Repeat(" ", max(columnWidth-format.VisibleWidth(cell), 0)+columnGap))
+			}
+		}
+		lines[row] = strings.TrimRight(line.String(), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// viewPane renders the typed out part of a single response, followed by the error of the provider if it failed
+func (m model) viewPane(pane pane) string {
+	response := format.TrimWhitespace(pane.response)
+	if len(response) > pane.displayedContentLength {
+		response = response[:pane.displayedContentLength]
+	}
+	content := commands.HighlightCommands(response)
+
+	if pane.err != nil && pane.displayedContentLength >= len(pane.response) {
+		if content != "" {
+			content += "\n\n"
+		}
+		content += "\033[31m" + pane.err.Error() + "\033[0m"
+	} else if content == "" && len(m.panes) > 1 && !m.isDone {
+		content = m.spinner.View() + "Waiting..."
+	}
+	return content
+}
+
+// riskLabel returns the colored risk shown next to a command, if the model gave one
+func riskLabel(risk string) string {
+	switch risk {
+	case commands.RiskLow:
+		return " \033[32m(low risk)\033[0m"
+	case commands.RiskMedium:
+		return " \033[33m(medium risk)\033[0m"
+	case commands.RiskHigh:
+		return " \033[31m(high risk)\033[0m"
+	}
+	return ""
+}
+
+// pullStatus describes the progress of a model pull, once it is done the status is cleared again
+func pullStatus(msg PullMsg) string {
+	if msg.Status == "success" {
+		return ""
+	}
+	if msg.Total <= 0 {
+		return fmt.Sprintf("Pulling %s: %s...", msg.Model, msg.Status)
+	}
+	return fmt.Sprintf("Pulling %s: %s %d%% (%s/%s)", msg.Model, msg.Status, msg.Completed*100/msg.Total, format.FormatBytes(msg.Completed), format.FormatBytes(msg.Total))
+}
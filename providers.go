@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/llms"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/replay"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// providerFlags holds the command line flags that configure a provider
+type providerFlags struct {
+	model       string
+	profile     string
+	temperature string
+	topP        string
+	topK        string
+	maxTokens   string
+	safety      string
+	fixture     string
+}
+
+// newProvider creates, sets up and validates the provider serving a run mode and returns it along with its options.
+// If interactive is set the user may be asked for missing credentials.
+func newProvider(runMode string, flags providerFlags, interactive bool) (llms.Provider, llms.Options, error) {
+	provider, opts, err := setupProvider(runMode, flags, interactive)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	err = provider.Validate()
+
+	// Replays are played back as recorded, the delays in a fixture are not timed
+	if runMode == "replay" {
+		if err != nil {
+			return nil, opts, fmt.Errorf("Error initializing %s: %w", runMode, err)
+		}
+		return provider, opts, nil
+	}
+
+	// The pull of a missing model is not timed, only the response after it
+	timed := llms.WithTimeouts(provider, opts.Timeouts)
+
+	// Offer to pull a missing ollama model, it is downloaded once the TUI shows the progress
+	if local, ok := provider.(*ollama.Provider); ok && interactive && errors.Is(err, ollama.ErrModelNotInstalled) && confirmPull(opts.Model) {
+		return ollama.WithPull(local, timed, func(progress ollama.PullProgress) {
+			p.Send(tea.PullMsg{Model: progress.Model, Status: progress.Status, Completed: progress.Completed, Total: progress.Total})
+		}), opts, nil
+	}
+
+	if err != nil {
+		return nil, opts, fmt.Errorf("Error initializing %s: %w", runMode, err)
+	}
+
+	return timed, opts, nil
+}
+
+// primaryProvider creates the provider answering the prompt, with the fallback providers chained behind it.
+// If the primary provider is not usable the first usable fallback answers instead, onAnswer is told which one
+// answered. If record is set the response is saved to that fixture file.
+func primaryProvider(runMode string, flags providerFlags, withRetry func(llms.Provider) llms.Provider, record string, onAnswer func(name string)) (llms.Provider, error) {
+	// Replays never fall back so they stay deterministic and offline
+	var fallbacks []string
+	if runMode != "replay" {
+		fallbacks = fallbackChain(runMode, flags.profile)
+	}
+
+	var candidates []llms.Candidate
+	primary, _, primaryErr := newProvider(runMode, flags, true)
+	if primaryErr == nil {
+		// Nor do they retry, a recorded error is already the one left after the retries of the recorded run
+		if runMode != "replay" {
+			primary = withRetry(primary)
+		}
+		candidates = append(candidates, llms.Candidate{Name: providerLabel(runMode, flags.profile), Provider: primary})
+	} else if len(fallbacks) == 0 {
+		return nil, primaryErr
+	} else {
+		log.Printf("Warning: Skipping %s: %v\n", providerLabel(runMode, flags.profile), primaryErr)
+	}
+
+	// Chain the fallback providers behind the primary one, each is only set up once the one before it failed
+	for _, entry := range fallbacks {
+		mode, profile, _ := strings.Cut(entry, ":")
+		candidates = append(candidates, llms.Candidate{Name: entry, Connect: func() (llms.Provider, error) {
+			fallback, _, err := newProvider(mode, providerFlags{profile: profile}, false)
+			if err != nil {
+				return nil, err
+			}
+			return withRetry(fallback), nil
+		}})
+	}
+
+	provider := candidates[0].Provider
+	if len(candidates) > 1 || primaryErr != nil {
+		provider = llms.WithFallback(candidates, llms.FallbackHooks{
+			OnFallback: func(failed string, err error, next string) {
+				p.Send(tea.FallbackMsg{Failed: failed, Err: err, Next: next})
+			},
+			OnAnswer: onAnswer,
+		})
+	}
+
+	if record != "" {
+		provider = replay.Record(provider, record)
+	}
+
+	return provider, nil
+}
+
+// setupProvider creates and sets up the provider serving a run mode without validating it
+func setupProvider(runMode string, flags providerFlags, interactive bool) (llms.Provider, llms.Options, error) {
+	opts, err := providerOptions(runMode, flags, interactive)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	provider, err := llms.Get(providerName(runMode))
+	if err != nil && runMode == "local" {
+		return nil, opts, errors.New("Invalid LOCAL_BACKEND. Please use one of: " + strings.Join(localBackends, ", ") + ".")
+	} else if err != nil {
+		return nil, opts, errors.New("Invalid mode. Please use one of: " + strings.Join(runModes, ", ") + ".")
+	}
+
+	err = provider.Setup(opts)
+	if err != nil {
+		return nil, opts, fmt.Errorf("Error setting up %s: %w", runMode, err)
+	}
+
+	return provider, opts, nil
+}
+
+// listModels prints the models offered by the provider serving a run mode
+func listModels(runMode string, flags providerFlags) error {
+	provider, _, err := setupProvider(runMode, flags, true)
+	if err != nil {
+		return err
+	}
+
+	lister, ok := provider.(llms.ModelLister)
+	if !ok {
+		return fmt.Errorf("Listing models is not supported in %s mode", runMode)
+	}
+
+	models, err := lister.Models(context.Background())
+	if err != nil {
+		return fmt.Errorf("Error listing models: %w", err)
+	}
+
+	if len(models) == 0 {
+		fmt.Printf("No models available in %s mode.\n", runMode)
+		return nil
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].String() < models[j].String() })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTAG\tSIZE\tMODIFIED")
+	for _, m := range models {
+		tag, size, modified := "-", "-", "-"
+		if m.Tag != "" {
+			tag = m.Tag
+		}
+		if m.Size > 0 {
+			size = format.FormatBytes(m.Size)
+		}
+		if !m.Modified.IsZero() {
+			modified = m.Modified.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, tag, size, modified)
+	}
+	return w.Flush()
+}
+
+// providerOptions reads the options of the provider serving a run mode from the flags and settings
+func providerOptions(runMode string, flags providerFlags, interactive bool) (llms.Options, error) {
+	var opts llms.Options
+	var err error
+
+	opts.Timeouts, err = readTimeouts()
+	if err != nil {
+		return opts, fmt.Errorf("Error reading timeouts: %w", err)
+	}
+
+	if runMode == "gemini" {
+		// A credential command replaces the stored key, it is run once the key is needed
+		opts.CredentialCommand = readSetting("GEMINI_CREDENTIAL_COMMAND")
+		if opts.CredentialCommand == "" {
+			opts.APIKey, err = readGeminiKey(interactive)
+			if err != nil {
+				return opts, err
+			}
+		}
+		opts.Model = settingOr(flags.model, "GEMINI_MODEL")
+		opts.Safety = settingOr(flags.safety, "GEMINI_SAFETY")
+		opts.Generation, err = readGenerationConfig(flags.temperature, flags.topP, flags.topK, flags.maxTokens)
+		if err != nil {
+			return opts, fmt.Errorf("Error reading generation parameters: %w", err)
+		}
+	} else if runMode == "local" && providerName(runMode) == "llamacpp" {
+		opts.BaseURL = readSetting("LLAMACPP_HOST")
+		opts.Template = readSetting("LLAMACPP_TEMPLATE")
+		if stop := readSetting("LLAMACPP_STOP"); stop != "" {
+			opts.Stop = strings.Split(stop, ",")
+		}
+	} else if runMode == "local" {
+		opts.Model = flags.model
+		if flags.model == "" {
+			opts.Model, err = io.ReadFromKeyring("OLLAMA_MODEL")
+			if err != nil {
+				return opts, fmt.Errorf("Error reading model: %w", err)
+			}
+		}
+		opts.Network, err = readNetwork("OLLAMA")
+		if err != nil {
+			return opts, err
+		}
+	} else if runMode == "remote" {
+		opts.Profile = flags.profile
+		opts.Model = flags.model
+	} else if runMode == "openai" {
+		opts.BaseURL = readSetting("OPENAI_BASE_URL")
+		opts.APIKey = readSetting("OPENAI_API_KEY")
+		opts.Model = settingOr(flags.model, "OPENAI_MODEL")
+	} else if runMode == "anthropic" {
+		opts.BaseURL = readSetting("ANTHROPIC_BASE_URL")
+		opts.APIKey = readSetting("ANTHROPIC_API_KEY")
+		opts.Model = settingOr(flags.model, "ANTHROPIC_MODEL")
+	} else if runMode == "replay" {
+		opts.Fixture = flags.fixture
+	}
+
+	return opts, nil
+}
+
+// readNetwork reads the proxy and TLS settings of a provider, such as OLLAMA_PROXY and OLLAMA_CA_FILE for the OLLAMA prefix
+func readNetwork(prefix string) (llms.Network, error) {
+	network := llms.Network{
+		Proxy:      readSetting(prefix + "_PROXY"),
+		CAFile:     readSetting(prefix + "_CA_FILE"),
+		ClientCert: readSetting(prefix + "_CLIENT_CERT"),
+		ClientKey:  readSetting(prefix + "_CLIENT_KEY"),
+	}
+
+	if insecure := readSetting(prefix + "_INSECURE_SKIP_VERIFY"); insecure != "" {
+		var err error
+		network.InsecureSkipVerify, err = strconv.ParseBool(insecure)
+		if err != nil {
+			return network, fmt.Errorf("Invalid %s_INSECURE_SKIP_VERIFY setting %q, it has to be true or false", prefix, insecure)
+		}
+	}
+
+	return network, nil
+}
+
+// confirmPull asks the user whether a missing ollama model should be pulled
+func confirmPull(model string) bool {
+	if !io.StdinIsTerminal() {
+		return false
+	}
+
+	fmt.Printf("The model %s is not installed in ollama. Do you want to pull it now? [Y/n]: ", model)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// readGeminiKey reads the Gemini API key, if interactive is set the user is asked for it when none is stored
+func readGeminiKey(interactive bool) (string, error) {
+	// Access your API key from keyring or environment variable (backwards compatible with previous versions)
+	apiKey := os.Getenv("GOOGLE_AI_KEY")
+
+	if apiKey == "" {
+		apiKey, _ = io.ReadFromKeyring("GOOGLE_AI_KEY")
+	}
+
+	if apiKey != "" {
+		return apiKey, nil
+	}
+
+	if !interactive {
+		return "", errors.New("no Gemini API key found")
+	}
+
+	// If no API key is found, prompt the user to enter it
+	fmt.Println("No API key found.")
+	fmt.Println("Please visit https://aistudio.google.com/app/apikey to obtain your API key.")
+	fmt.Print("Enter your API key here: ")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if scanner.Scan() {
+		apiKey = scanner.Text()
+
+		// Check if the API key is valid
+		isValid, err := gemini.IsKeyValid(apiKey)
+		if !isValid {
+			fmt.Println("Invalid API key. Please try again.")
+			os.Exit(1)
+		} else if err != nil {
+			return "", fmt.Errorf("Error validating API key: %w", err)
+		}
+
+		os.Setenv("GOOGLE_AI_KEY", apiKey)
+		if err := io.SaveToKeyring("GOOGLE_AI_KEY", apiKey); err != nil {
+			fmt.Println("Failed to automatically append the API key to keyring. Please add the following line to your .bashrc, .zshrc, or equivalent file manually (replace the {API_KEY_HERE} with your API key):")
+			fmt.Println("export GOOGLE_AI_KEY={API_KEY_HERE}")
+		} else {
+			fmt.Print("API key set successfully for future sessions. \n\n")
+		}
+	} else if scanner.Err() != nil {
+		return "", fmt.Errorf("Error reading API key: %w", scanner.Err())
+	}
+
+	return apiKey, nil
+}
+
+// fallbackChain returns the providers to fall back to in order, leaving out the one that is already used
+func fallbackChain(runMode string, profile string) []string {
+	used := providerLabel(runMode, profile)
+
+	var chain []string
+	for _, entry := range strings.Split(readSetting("FALLBACK"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry == used {
+			continue
+		}
+		mode, _, _ := strings.Cut(entry, ":")
+		if !isRunMode(mode) {
+			log.Printf("Warning: Ignoring unknown fallback provider %s\n", entry)
+			continue
+		}
+		chain = append(chain, entry)
+	}
+	return chain
+}
+
+// providerLabel names a run mode the way the fallback chain refers to it
+func providerLabel(runMode string, profile string) string {
+	if runMode == "remote" && profile != "" {
+		return "remote:" + profile
+	}
+	return runMode
+}